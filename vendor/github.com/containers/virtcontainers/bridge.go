@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import "fmt"
+
+// bridgeType describes the type of PCI bridge a device can be attached to.
+type bridgeType string
+
+const (
+	// pciBridge is a conventional PCI bridge, used with the "pc" machine type.
+	pciBridge bridgeType = "pci"
+
+	// pcieBridge is a PCI Express bridge, used with the "q35" machine type.
+	pcieBridge bridgeType = "pcie"
+)
+
+// pciBridgeMaxCapacity is the number of device slots a single bridge can
+// offer. Slot 0 is reserved for the bridge's own chipset function, leaving
+// 31 usable slots.
+const pciBridgeMaxCapacity = 31
+
+const (
+	// defaultBridges is the number of PCI/PCIe bridges added to a pod by
+	// default, should the pod configuration not request otherwise.
+	defaultBridges uint32 = 1
+
+	// maxBridges is the maximum number of bridges allowed per pod. This
+	// keeps the number of extra buses QEMU has to manage, and the PCI
+	// topology complexity, within sane bounds.
+	maxBridges uint32 = 5
+)
+
+// Bridge is a PCI or PCIe bridge attached to the guest machine that devices
+// can be plugged into. It tracks which slots are occupied so that hot-plug
+// can keep working past the small number of root ports a machine type
+// exposes natively.
+type Bridge struct {
+	// Type is the bridge type (pci or pcie).
+	Type bridgeType
+
+	// ID is the unique identifier of the bridge, also used as its QEMU
+	// bus name (e.g. "pci-bridge-0").
+	ID string
+
+	// Address maps an occupied slot to the ID of the device plugged into
+	// it. Slot 0 is never present as it is reserved for the bridge.
+	Address map[int]string
+}
+
+// newBridge creates a Bridge of the given type with an empty address map.
+func newBridge(bType bridgeType, id string) Bridge {
+	return Bridge{
+		Type:    bType,
+		ID:      id,
+		Address: make(map[int]string),
+	}
+}
+
+// newBridges returns a slice of count newly created bridges of type bType,
+// named sequentially from "<bType>-bridge-0" (e.g. "pci-bridge-0" or
+// "pcie-bridge-0").
+func newBridges(count uint32, bType bridgeType) []Bridge {
+	if count > maxBridges {
+		count = maxBridges
+	}
+
+	bridges := make([]Bridge, 0, count)
+	for i := uint32(0); i < count; i++ {
+		bridges = append(bridges, newBridge(bType, fmt.Sprintf("%s-bridge-%d", bType, i)))
+	}
+
+	return bridges
+}
+
+// addDevice reserves the first free slot on the bridge for id and returns
+// it. It returns an error if the bridge has no free slot left.
+func (b *Bridge) addDevice(id string) (int, error) {
+	for slot := 1; slot <= pciBridgeMaxCapacity; slot++ {
+		if _, ok := b.Address[slot]; ok {
+			continue
+		}
+
+		b.Address[slot] = id
+		return slot, nil
+	}
+
+	return -1, fmt.Errorf("Unable to hot plug device %s: bridge %s is full", id, b.ID)
+}
+
+// removeDevice releases the slot occupied by id on the bridge, if any.
+func (b *Bridge) removeDevice(id string) {
+	for slot, devID := range b.Address {
+		if devID == id {
+			delete(b.Address, slot)
+			return
+		}
+	}
+}
+
+// addDeviceToBridges walks bridges in order and reserves a slot for id on
+// the first bridge that still has free capacity. It returns the bridge
+// chosen along with the allocated slot.
+func addDeviceToBridges(id string, bridges []Bridge) (*Bridge, int, error) {
+	for i := range bridges {
+		slot, err := bridges[i].addDevice(id)
+		if err != nil {
+			continue
+		}
+
+		return &bridges[i], slot, nil
+	}
+
+	return nil, -1, fmt.Errorf("Unable to hot plug device %s: all %d bridges are full, raise DefaultBridges", id, len(bridges))
+}
+
+// removeDeviceFromBridges walks bridges looking for id and frees its slot
+// on whichever bridge holds it.
+func removeDeviceFromBridges(id string, bridges []Bridge) {
+	for i := range bridges {
+		bridges[i].removeDevice(id)
+	}
+}
+
+// qemuArgs returns the "-device" QEMU command line fragment that attaches
+// the bridge itself to the machine, using idx to derive its slot address
+// (0x<idx+1>) on the root bus; the bus and root port IDs are derived from
+// b.ID. PCIe bridges (q35) need a root port to hang
+// off of, added via ioh3420, before the pci-bridge itself can attach to
+// it; conventional PCI bridges (pc) attach directly to the root bus.
+func (b *Bridge) qemuArgs(idx int) []string {
+	addr := fmt.Sprintf("0x%x", idx+1)
+
+	if b.Type == pcieBridge {
+		rootPort := fmt.Sprintf("%s-root-port", b.ID)
+		return []string{
+			"-device", fmt.Sprintf("ioh3420,id=%s,bus=pcie.0,addr=%s", rootPort, addr),
+			"-device", fmt.Sprintf("pci-bridge,id=%s,bus=%s", b.ID, rootPort),
+		}
+	}
+
+	return []string{
+		"-device", fmt.Sprintf("pci-bridge,id=%s,bus=pci.0,addr=%s", b.ID, addr),
+	}
+}
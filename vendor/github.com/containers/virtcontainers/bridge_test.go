@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import "testing"
+
+func TestBridgeAddDeviceAllocatesSlotsStartingAtOne(t *testing.T) {
+	b := newBridge(pciBridge, "pci-bridge-0")
+
+	slot, err := b.addDevice("dev0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if slot != 1 {
+		t.Fatalf("expected first allocated slot to be 1, got %d", slot)
+	}
+
+	slot, err = b.addDevice("dev1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if slot != 2 {
+		t.Fatalf("expected second allocated slot to be 2, got %d", slot)
+	}
+}
+
+func TestBridgeAddDeviceExhaustion(t *testing.T) {
+	b := newBridge(pcieBridge, "pcie-bridge-0")
+
+	for i := 0; i < pciBridgeMaxCapacity; i++ {
+		if _, err := b.addDevice(string(rune('a' + i))); err != nil {
+			t.Fatalf("unexpected error allocating slot %d: %s", i, err)
+		}
+	}
+
+	if _, err := b.addDevice("overflow"); err == nil {
+		t.Fatal("expected an error once the bridge is full")
+	}
+}
+
+func TestBridgeRemoveDeviceFreesSlot(t *testing.T) {
+	b := newBridge(pciBridge, "pci-bridge-0")
+
+	if _, err := b.addDevice("dev0"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b.removeDevice("dev0")
+
+	if len(b.Address) != 0 {
+		t.Fatalf("expected the bridge to have no occupied slots after removal, got %d", len(b.Address))
+	}
+
+	slot, err := b.addDevice("dev1")
+	if err != nil {
+		t.Fatalf("unexpected error reusing a freed slot: %s", err)
+	}
+	if slot != 1 {
+		t.Fatalf("expected the freed slot 1 to be reused, got %d", slot)
+	}
+}
+
+func TestAddDeviceToBridgesSelectsFirstBridgeWithCapacity(t *testing.T) {
+	for _, bType := range []bridgeType{pciBridge, pcieBridge} {
+		bridges := newBridges(2, bType)
+
+		for i := 0; i < pciBridgeMaxCapacity; i++ {
+			if _, _, err := addDeviceToBridges(string(rune('a'+i)), bridges); err != nil {
+				t.Fatalf("%s: unexpected error filling first bridge: %s", bType, err)
+			}
+		}
+
+		bridge, slot, err := addDeviceToBridges("overflow-dev", bridges)
+		if err != nil {
+			t.Fatalf("%s: expected device to be placed on the second bridge, got error: %s", bType, err)
+		}
+		if bridge.ID != bridges[1].ID {
+			t.Fatalf("%s: expected device to land on %s, got %s", bType, bridges[1].ID, bridge.ID)
+		}
+		if slot != 1 {
+			t.Fatalf("%s: expected the first slot of the second bridge, got %d", bType, slot)
+		}
+	}
+}
+
+func TestAddDeviceToBridgesAllFull(t *testing.T) {
+	bridges := newBridges(1, pciBridge)
+
+	for i := 0; i < pciBridgeMaxCapacity; i++ {
+		if _, _, err := addDeviceToBridges(string(rune('a'+i)), bridges); err != nil {
+			t.Fatalf("unexpected error filling the only bridge: %s", err)
+		}
+	}
+
+	if _, _, err := addDeviceToBridges("overflow-dev", bridges); err == nil {
+		t.Fatal("expected an error when every bridge is full")
+	}
+}
+
+func TestBridgeQemuArgsPCI(t *testing.T) {
+	b := newBridge(pciBridge, "pci-bridge-0")
+
+	args := b.qemuArgs(0)
+	want := []string{"-device", "pci-bridge,id=pci-bridge-0,bus=pci.0,addr=0x1"}
+
+	if len(args) != len(want) {
+		t.Fatalf("got %#v, want %#v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("got %#v, want %#v", args, want)
+		}
+	}
+}
+
+func TestBridgeQemuArgsPCIeAddsRootPort(t *testing.T) {
+	b := newBridge(pcieBridge, "pcie-bridge-1")
+
+	args := b.qemuArgs(1)
+	want := []string{
+		"-device", "ioh3420,id=pcie-bridge-1-root-port,bus=pcie.0,addr=0x2",
+		"-device", "pci-bridge,id=pcie-bridge-1,bus=pcie-bridge-1-root-port",
+	}
+
+	if len(args) != len(want) {
+		t.Fatalf("got %#v, want %#v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("got %#v, want %#v", args, want)
+		}
+	}
+}
+
+func TestRemoveDeviceFromBridges(t *testing.T) {
+	bridges := newBridges(2, pcieBridge)
+
+	if _, _, err := addDeviceToBridges("dev0", bridges); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	removeDeviceFromBridges("dev0", bridges)
+
+	for _, b := range bridges {
+		if len(b.Address) != 0 {
+			t.Fatalf("expected no bridge to hold dev0 after removal, bridge %s still has %d entries", b.ID, len(b.Address))
+		}
+	}
+}
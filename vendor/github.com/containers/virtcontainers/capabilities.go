@@ -0,0 +1,31 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+// capabilities describes what a hypervisor backend supports, so that
+// callers can probe for a feature before relying on it instead of
+// discovering its absence from an addDevice/hotplugAddDevice error.
+type capabilities struct {
+	vfioSupported bool
+}
+
+// supportsVFIO reports whether the backend advertises VFIO passthrough
+// support (for qemu: VFIOMode is not VFIOModeDisabled). qemu's addDevice
+// and hotplugAddDevice do not consult it before attaching a VFIODevice.
+func (c capabilities) supportsVFIO() bool {
+	return c.vfioSupported
+}
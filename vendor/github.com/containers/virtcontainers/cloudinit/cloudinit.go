@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cloudinit builds cloud-init seed images (NoCloud or
+// ConfigDrive) that can be attached to a guest as a read-only CD-ROM so
+// that generic cloud images can be brought up without baking credentials
+// or networking into the guest image itself.
+package cloudinit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Format selects the on-disk layout of the seed image.
+type Format string
+
+const (
+	// NoCloud is the cloud-init "NoCloud" data source layout: a flat
+	// user-data/meta-data/network-config triplet at the image root.
+	NoCloud Format = "nocloud"
+
+	// ConfigDrive is the OpenStack config-drive layout, nesting the
+	// same data under openstack/latest/.
+	ConfigDrive Format = "configdrive"
+)
+
+// volumeLabels maps a Format to the ISO9660/vfat volume label cloud-init
+// expects to find when searching for the data source.
+var volumeLabels = map[Format]string{
+	NoCloud:     "cidata",
+	ConfigDrive: "config-2",
+}
+
+// Data holds the raw cloud-init documents to embed in the seed image.
+type Data struct {
+	UserData    []byte
+	MetaData    []byte
+	NetworkData []byte
+	Format      Format
+}
+
+// GenerateSeedISO lays out data's documents under a temporary staging
+// directory and packs them into an ISO9660 image named seedName inside
+// destDir, returning the resulting image path. It shells out to
+// genisoimage/mkisofs, falling back to building a small vfat image with
+// mkfs.vfat and mcopy if the ISO9660 image cannot be built (neither tool
+// is available, or the one found fails).
+func GenerateSeedISO(destDir, seedName string, data Data) (string, error) {
+	stagingDir, err := ioutil.TempDir("", "cloudinit-seed-")
+	if err != nil {
+		return "", fmt.Errorf("Unable to create cloud-init staging directory: %s", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := layoutFiles(stagingDir, data); err != nil {
+		return "", err
+	}
+
+	imgPath := filepath.Join(destDir, seedName)
+	label := volumeLabels[data.Format]
+	if label == "" {
+		return "", fmt.Errorf("Unknown cloud-init format %q", data.Format)
+	}
+
+	isoErr := packISO9660(stagingDir, imgPath, label)
+	if isoErr == nil {
+		return imgPath, nil
+	}
+
+	vfatErr := packVFAT(stagingDir, imgPath, label)
+	if vfatErr == nil {
+		return imgPath, nil
+	}
+
+	return "", fmt.Errorf("Unable to build cloud-init seed image: %s; vfat fallback also failed: %s", isoErr, vfatErr)
+}
+
+// layoutFiles writes data's documents into stagingDir following the
+// directory structure data.Format expects.
+func layoutFiles(stagingDir string, data Data) error {
+	root := stagingDir
+
+	if data.Format == ConfigDrive {
+		root = filepath.Join(stagingDir, "openstack", "latest")
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return fmt.Errorf("Unable to create config-drive layout: %s", err)
+		}
+	}
+
+	files := map[string][]byte{
+		userDataFilename(data.Format):    data.UserData,
+		metaDataFilename(data.Format):    data.MetaData,
+		networkDataFilename(data.Format): data.NetworkData,
+	}
+
+	for name, content := range files {
+		if len(content) == 0 {
+			continue
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+			return fmt.Errorf("Unable to write cloud-init file %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func userDataFilename(f Format) string {
+	if f == ConfigDrive {
+		return "user_data"
+	}
+	return "user-data"
+}
+
+func metaDataFilename(f Format) string {
+	if f == ConfigDrive {
+		return "meta_data.json"
+	}
+	return "meta-data"
+}
+
+func networkDataFilename(f Format) string {
+	if f == ConfigDrive {
+		return "network_data.json"
+	}
+	return "network-config"
+}
+
+// isoTools lists, in preference order, the external tools that can pack a
+// directory tree into an ISO9660 image.
+var isoTools = []string{"genisoimage", "mkisofs"}
+
+// packISO9660 packs srcDir into an ISO9660 image at isoPath with the
+// given volume label, using whichever of genisoimage/mkisofs is
+// available on the host.
+func packISO9660(srcDir, isoPath, label string) error {
+	for _, tool := range isoTools {
+		if _, err := exec.LookPath(tool); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(tool, "-output", isoPath, "-volid", label, "-joliet", "-rock", srcDir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s failed to build cloud-init seed image: %s: %s", tool, err, out)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("neither genisoimage nor mkisofs found in PATH")
+}
+
+// vfatImageSizeBytes is the fixed size given to the vfat fallback image.
+// Cloud-init documents are tiny (typically a few KiB), so this comfortably
+// covers both the NoCloud and ConfigDrive layouts with room to spare.
+const vfatImageSizeBytes = 4 * 1024 * 1024
+
+// packVFAT packs srcDir into a vfat image at imgPath with the given
+// volume label, using mkfs.vfat and mcopy. It is the fallback used when
+// packISO9660 fails to build an ISO9660 image.
+func packVFAT(srcDir, imgPath, label string) error {
+	mkfsVFAT, err := exec.LookPath("mkfs.vfat")
+	if err != nil {
+		return fmt.Errorf("mkfs.vfat not found in PATH: %s", err)
+	}
+
+	mcopy, err := exec.LookPath("mcopy")
+	if err != nil {
+		return fmt.Errorf("mcopy not found in PATH: %s", err)
+	}
+
+	img, err := os.Create(imgPath)
+	if err != nil {
+		return fmt.Errorf("Unable to create vfat image %s: %s", imgPath, err)
+	}
+	if err := img.Truncate(vfatImageSizeBytes); err != nil {
+		img.Close()
+		return fmt.Errorf("Unable to size vfat image %s: %s", imgPath, err)
+	}
+	if err := img.Close(); err != nil {
+		return fmt.Errorf("Unable to finalize vfat image %s: %s", imgPath, err)
+	}
+
+	cmd := exec.Command(mkfsVFAT, "-n", label, imgPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkfs.vfat failed to format cloud-init seed image: %s: %s", err, out)
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("Unable to list cloud-init staging directory: %s", err)
+	}
+
+	for _, entry := range entries {
+		cmd := exec.Command(mcopy, "-s", "-i", imgPath, filepath.Join(srcDir, entry.Name()), "::")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("mcopy failed to copy %s into the cloud-init seed image: %s: %s", entry.Name(), err, out)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+
+	"github.com/containers/virtcontainers/cloudinit"
+)
+
+// CloudInitFormat selects the cloud-init data source layout used when
+// generating a seed image for a pod.
+type CloudInitFormat string
+
+const (
+	// CloudInitNoCloud is the cloud-init "NoCloud" data source.
+	CloudInitNoCloud CloudInitFormat = "nocloud"
+
+	// CloudInitConfigDrive is the OpenStack config-drive data source.
+	CloudInitConfigDrive CloudInitFormat = "configdrive"
+)
+
+// cloudInitSeedName is the filename given to the generated seed image.
+const cloudInitSeedName = "seed.iso"
+
+// ovfEnvironmentName is the filename given to the OVF transport image.
+const ovfEnvironmentName = "ovf-env.iso"
+
+// CloudInitConfig carries the cloud-init documents used to seed a guest
+// image that expects to find its credentials and networking through the
+// NoCloud or ConfigDrive data sources, instead of having them baked in.
+type CloudInitConfig struct {
+	// UserData is the cloud-init user-data document.
+	UserData []byte
+
+	// MetaData is the cloud-init meta-data document.
+	MetaData []byte
+
+	// NetworkData is the cloud-init network-config document.
+	NetworkData []byte
+
+	// Format selects the data source layout used on the seed image.
+	Format CloudInitFormat
+}
+
+// enabled reports whether a CloudInitConfig carries anything to seed.
+func (c CloudInitConfig) enabled() bool {
+	return len(c.UserData) > 0 || len(c.MetaData) > 0 || len(c.NetworkData) > 0
+}
+
+// toCloudInitData converts a CloudInitConfig into the cloudinit
+// subpackage's Data type.
+func (c CloudInitConfig) toCloudInitData() cloudinit.Data {
+	format := cloudinit.NoCloud
+	if c.Format == CloudInitConfigDrive {
+		format = cloudinit.ConfigDrive
+	}
+
+	return cloudinit.Data{
+		UserData:    c.UserData,
+		MetaData:    c.MetaData,
+		NetworkData: c.NetworkData,
+		Format:      format,
+	}
+}
+
+// kernelParam returns the "ds=..." kernel parameter matching the data
+// source format, passed to the guest through AddKernelParam.
+func (c CloudInitConfig) kernelParam() Param {
+	if c.Format == CloudInitConfigDrive {
+		return Param{Key: "ds", Value: "configdrive"}
+	}
+
+	return Param{Key: "ds", Value: "nocloud-net"}
+}
+
+// generateSeedISO builds the cloud-init seed ISO for config in destDir
+// and returns its path.
+func (c CloudInitConfig) generateSeedISO(destDir string) (string, error) {
+	if !c.enabled() {
+		return "", fmt.Errorf("CloudInitConfig has no user-data, meta-data or network-data to seed")
+	}
+
+	return cloudinit.GenerateSeedISO(destDir, cloudInitSeedName, c.toCloudInitData())
+}
+
+// cdromDriveArg builds the "-drive ...,media=cdrom,readonly=on" QEMU
+// command line fragment used to attach a read-only seed or OVF
+// environment image.
+func cdromDriveArg(path string) string {
+	return fmt.Sprintf("file=%s,media=cdrom,readonly=on", path)
+}
+
+// writeOVFEnvironment writes HypervisorConfig.OVFEnvironment to destDir
+// as a second read-only CD-ROM image, for guest images that expect OVF
+// transport instead of (or alongside) cloud-init.
+func writeOVFEnvironment(destDir string, ovfEnvironment []byte) (string, error) {
+	return cloudinit.GenerateSeedISO(destDir, ovfEnvironmentName, cloudinit.Data{
+		UserData: ovfEnvironment,
+		Format:   cloudinit.NoCloud,
+	})
+}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// HostCPUInfo describes the host CPU as parsed from /proc/cpuinfo. It is
+// gathered once and reused, instead of re-reading /proc/cpuinfo every time
+// a single flag needs checking.
+type HostCPUInfo struct {
+	// VendorID is the CPU vendor string (e.g. "GenuineIntel").
+	VendorID string
+
+	// ModelName is the human readable CPU model name.
+	ModelName string
+
+	// PhysicalCores is the number of distinct "physical id" entries
+	// found.
+	PhysicalCores int
+
+	// LogicalCores is the number of "processor" entries found.
+	LogicalCores int
+
+	// Flags holds every flag listed on the "flags" line, keyed by
+	// name, for cheap membership tests (e.g. Flags["vmx"]).
+	Flags map[string]bool
+}
+
+// warnNestedVirtUnavailable is called by NewHostCPUInfo when the host does
+// not expose virtualization extensions. It defaults to a no-op; hypervisor
+// backends (e.g. qemu) can override it to log a warning and drop
+// virtualization-extension CPU flags such as +vmx/+svm from their command
+// line.
+var warnNestedVirtUnavailable = func(info *HostCPUInfo) {}
+
+// NewHostCPUInfo parses cpuInfoPath (typically /proc/cpuinfo) and returns
+// the resulting HostCPUInfo.
+func NewHostCPUInfo(cpuInfoPath string) (*HostCPUInfo, error) {
+	f, err := os.Open(cpuInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &HostCPUInfo{
+		Flags: make(map[string]bool),
+	}
+
+	physicalIDs := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "processor":
+			info.LogicalCores++
+		case "physical id":
+			physicalIDs[value] = struct{}{}
+		case "vendor_id":
+			if info.VendorID == "" {
+				info.VendorID = value
+			}
+		case "model name":
+			if info.ModelName == "" {
+				info.ModelName = value
+			}
+		case "flags", "Features":
+			for _, flag := range strings.Fields(value) {
+				info.Flags[flag] = true
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	info.PhysicalCores = len(physicalIDs)
+	if info.PhysicalCores == 0 && info.LogicalCores > 0 {
+		info.PhysicalCores = 1
+	}
+
+	if !info.SupportsNested() {
+		warnNestedVirtUnavailable(info)
+	}
+
+	return info, nil
+}
+
+// SupportsNested reports whether the host CPU exposes the virtualization
+// extensions (Intel VMX or AMD SVM) required to run a nested hypervisor.
+func (info *HostCPUInfo) SupportsNested() bool {
+	return info.Flags["vmx"] || info.Flags["svm"]
+}
+
+// SupportsHugePages1G reports whether the host CPU can back 1 GiB huge
+// pages (the pdpe1gb flag).
+func (info *HostCPUInfo) SupportsHugePages1G() bool {
+	return info.Flags["pdpe1gb"]
+}
+
+// RunningOnVMM reports whether the host itself is running as a guest,
+// i.e. the hypervisor flag is present in /proc/cpuinfo.
+func (info *HostCPUInfo) RunningOnVMM() bool {
+	return info.Flags["hypervisor"]
+}
+
+// oneGiBInMiB is the size of a 1 GiB huge page expressed in MiB, used to
+// validate that DefaultMemSz is a multiple of it.
+const oneGiBInMiB = 1024
+
+// checkHugePages1G validates that, when 1 GiB huge pages are requested,
+// the host CPU can actually back them and memSzMiB is a multiple of 1 GiB.
+func checkHugePages1G(info *HostCPUInfo, memSzMiB uint32) error {
+	if memSzMiB%oneGiBInMiB != 0 {
+		return fmt.Errorf("HugePages requires DefaultMemSz to be a multiple of %d MiB, got %d", oneGiBInMiB, memSzMiB)
+	}
+
+	if !info.SupportsHugePages1G() {
+		return fmt.Errorf("HugePages requested but host CPU does not support 1 GiB huge pages (missing pdpe1gb)")
+	}
+
+	return nil
+}
+
+// ValidateHostCPUConstraints consults the host's /proc/cpuinfo to enforce
+// the HugePages and nested virtualization constraints that only apply to
+// hypervisor backends running directly on Linux (e.g. qemu). It is kept
+// out of HypervisorConfig.valid() because that method runs for every
+// HypervisorType, including backends such as HyperVHypervisor that target
+// hosts without a /proc/cpuinfo to read; those backends should not fail
+// to initialize because of a Linux-specific check. qemu-style backends
+// should call this from their own init, after HypervisorConfig.valid().
+func ValidateHostCPUConstraints(conf *HypervisorConfig) error {
+	hostCPU, err := NewHostCPUInfo(procCPUInfo)
+	if err != nil {
+		return err
+	}
+
+	if conf.HugePages {
+		if err := checkHugePages1G(hostCPU, conf.DefaultMemSz); err != nil {
+			return err
+		}
+	}
+
+	if !conf.DisableNestingChecks && !hostCPU.SupportsNested() {
+		conf.DisableNestingChecks = true
+	}
+
+	return nil
+}
+
+// RunningOnVMM checks if the system is running inside a VM.
+//
+// Deprecated: kept as a thin wrapper around NewHostCPUInfo for backward
+// compatibility; prefer NewHostCPUInfo(cpuInfoPath).RunningOnVMM().
+func RunningOnVMM(cpuInfoPath string) (bool, error) {
+	info, err := NewHostCPUInfo(cpuInfoPath)
+	if err != nil {
+		return false, err
+	}
+
+	return info.RunningOnVMM(), nil
+}
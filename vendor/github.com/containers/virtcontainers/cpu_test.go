@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import "testing"
+
+// TestHypervisorConfigValidDoesNotReadProcCPUInfo guards against
+// HypervisorConfig.valid() reaching back into /proc/cpuinfo. A
+// HyperVConfig-based pod runs on Windows hosts, which have no
+// /proc/cpuinfo; valid() reading it unconditionally used to make every
+// Hyper-V pod fail to initialize on its own target platform.
+func TestHypervisorConfigValidDoesNotReadProcCPUInfo(t *testing.T) {
+	conf := &HypervisorConfig{
+		KernelPath: "/kernel",
+		ImagePath:  "/image",
+		HyperV: HyperVConfig{
+			SwitchName: "external",
+			Generation: 2,
+		},
+	}
+
+	valid, err := conf.valid()
+	if !valid || err != nil {
+		t.Fatalf("expected a HyperVConfig-based HypervisorConfig to validate, got valid=%v err=%v", valid, err)
+	}
+}
+
+// TestValidateHostCPUConstraintsHugePagesNotMultiple ensures the
+// Linux-specific HugePages check moved out of valid() still rejects a
+// memory size that is not a multiple of 1 GiB.
+func TestValidateHostCPUConstraintsHugePagesNotMultiple(t *testing.T) {
+	info := &HostCPUInfo{Flags: map[string]bool{"pdpe1gb": true}}
+
+	if err := checkHugePages1G(info, 1500); err == nil {
+		t.Fatal("expected an error for a DefaultMemSz that is not a multiple of 1 GiB")
+	}
+
+	if err := checkHugePages1G(info, 2048); err != nil {
+		t.Fatalf("expected no error for a 1 GiB-aligned DefaultMemSz, got: %s", err)
+	}
+}
+
+// TestValidateHostCPUConstraintsMissingPDPE1GB ensures HugePages is
+// rejected when the host CPU lacks 1 GiB huge page support, even with an
+// aligned memory size.
+func TestValidateHostCPUConstraintsMissingPDPE1GB(t *testing.T) {
+	info := &HostCPUInfo{Flags: map[string]bool{}}
+
+	if err := checkHugePages1G(info, 2048); err == nil {
+		t.Fatal("expected an error when the host CPU does not support 1 GiB huge pages")
+	}
+}
@@ -0,0 +1,208 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VFIOMode describes how VFIO device passthrough is made available to the
+// guest. The qemu backend reads it only in capabilities(), where it tells
+// VFIOModeDisabled apart from the other modes; its addDevice and
+// hotplugAddDevice accept vfioDev devices whatever the mode.
+type VFIOMode int
+
+const (
+	// VFIOModeDisabled makes the backend report no VFIO passthrough
+	// support through capabilities().
+	VFIOModeDisabled VFIOMode = iota
+
+	// VFIOModeGuestKernel relies on the guest kernel's own IOMMU/vfio-pci
+	// support, with isolation enforced by the host IOMMU group.
+	VFIOModeGuestKernel
+
+	// VFIOModeVFIONoIOMMU uses vfio-pci's "no-iommu" mode, for hosts
+	// that lack IOMMU support. This weakens isolation guarantees and
+	// should only be used when the host cannot do better.
+	VFIOModeVFIONoIOMMU
+)
+
+// sysBusPCIDevices is the sysfs path under which every PCI device exposes
+// its iommu_group symlink. It is a var so tests can point it at a fake
+// sysfs tree.
+var sysBusPCIDevices = "/sys/bus/pci/devices"
+
+// sysKernelIOMMUGroups is the sysfs path under which each IOMMU group
+// lists the devices it contains. It is a var for the same reason as
+// sysBusPCIDevices.
+var sysKernelIOMMUGroups = "/sys/kernel/iommu_groups"
+
+// VFIODevice represents a PCI device handed off to the guest through
+// VFIO.
+type VFIODevice struct {
+	// BDF is the device's PCI address in "domain:bus:device.function"
+	// form (e.g. "0000:00:02.0").
+	BDF string
+
+	// IOMMUGroup is the IOMMU group the device belongs to, as resolved
+	// from /sys/bus/pci/devices/<bdf>/iommu_group.
+	IOMMUGroup int
+
+	// VendorID is the PCI vendor ID of the device.
+	VendorID uint16
+
+	// DeviceID is the PCI device ID of the device.
+	DeviceID uint16
+}
+
+// resolveVFIODevice inspects the host sysfs tree for bdf, resolving the
+// IOMMU group it belongs to and binding it to vfio-pci through
+// bindVFIOPCI. It returns an error if the device's IOMMU group cannot be
+// determined, if it cannot be bound, or if the group cannot be isolated
+// (another device in the same group is not bound to vfio-pci).
+func resolveVFIODevice(bdf string) (*VFIODevice, error) {
+	devPath := filepath.Join(sysBusPCIDevices, bdf)
+
+	groupLink := filepath.Join(devPath, "iommu_group")
+	groupTarget, err := os.Readlink(groupLink)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to resolve IOMMU group for device %s: %s", bdf, err)
+	}
+
+	group, err := strconv.Atoi(filepath.Base(groupTarget))
+	if err != nil {
+		return nil, fmt.Errorf("Malformed IOMMU group %q for device %s: %s", groupTarget, bdf, err)
+	}
+
+	if err := bindVFIOPCI(devPath, bdf); err != nil {
+		return nil, err
+	}
+
+	if err := checkIOMMUGroupIsolation(group, bdf); err != nil {
+		return nil, err
+	}
+
+	vendorID, err := readPCIHexAttr(devPath, "vendor")
+	if err != nil {
+		return nil, err
+	}
+
+	deviceID, err := readPCIHexAttr(devPath, "device")
+	if err != nil {
+		return nil, err
+	}
+
+	return &VFIODevice{
+		BDF:        bdf,
+		IOMMUGroup: group,
+		VendorID:   vendorID,
+		DeviceID:   deviceID,
+	}, nil
+}
+
+// bindVFIOPCI binds the PCI device at devPath to the vfio-pci driver by
+// writing to its driver_override sysfs attribute, leaving the actual
+// unbind/bind cycle to the driver core the next time it probes the
+// device. It is a no-op if the device is already bound to vfio-pci.
+func bindVFIOPCI(devPath, bdf string) error {
+	driverLink := filepath.Join(devPath, "driver")
+	if target, err := os.Readlink(driverLink); err == nil && filepath.Base(target) == "vfio-pci" {
+		return nil
+	}
+
+	overridePath := filepath.Join(devPath, "driver_override")
+	if _, err := os.Stat(overridePath); err != nil {
+		return fmt.Errorf("Unable to bind device %s to vfio-pci: missing driver_override: %s", bdf, err)
+	}
+
+	if err := os.WriteFile(overridePath, []byte("vfio-pci\n"), 0200); err != nil {
+		return fmt.Errorf("Unable to bind device %s to vfio-pci: %s", bdf, err)
+	}
+
+	return nil
+}
+
+// checkIOMMUGroupIsolation verifies that every other PCI device sharing
+// group is itself bound to vfio-pci, so that passing bdf through does not
+// leak access to sibling devices the guest was not granted.
+func checkIOMMUGroupIsolation(group int, bdf string) error {
+	groupDevicesDir := filepath.Join(sysKernelIOMMUGroups, strconv.Itoa(group), "devices")
+
+	entries, err := os.ReadDir(groupDevicesDir)
+	if err != nil {
+		return fmt.Errorf("Unable to enumerate IOMMU group %d devices: %s", group, err)
+	}
+
+	for _, entry := range entries {
+		sibling := entry.Name()
+		if sibling == bdf {
+			continue
+		}
+
+		driverLink := filepath.Join(sysBusPCIDevices, sibling, "driver")
+		target, err := os.Readlink(driverLink)
+		if err != nil {
+			return fmt.Errorf("IOMMU group %d is not isolated: device %s has no driver bound", group, sibling)
+		}
+
+		if filepath.Base(target) != "vfio-pci" {
+			return fmt.Errorf("IOMMU group %d is not isolated: device %s is bound to %s, not vfio-pci", group, sibling, filepath.Base(target))
+		}
+	}
+
+	return nil
+}
+
+// readPCIHexAttr reads a sysfs PCI attribute file (e.g. "vendor", "device")
+// containing a "0x"-prefixed hex value and parses it as a uint16.
+func readPCIHexAttr(devPath, attr string) (uint16, error) {
+	data, err := os.ReadFile(filepath.Join(devPath, attr))
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read PCI attribute %s for %s: %s", attr, devPath, err)
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x")), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("Malformed PCI attribute %s for %s: %s", attr, devPath, err)
+	}
+
+	return uint16(value), nil
+}
+
+// vfioBootArgs builds the "-device vfio-pci,..." QEMU command line
+// fragment used to attach dev at boot, on the bridge/slot allocated for
+// it.
+func vfioBootArgs(dev VFIODevice, bridge *Bridge, slot int) string {
+	return fmt.Sprintf("vfio-pci,host=%s,bus=%s,addr=0x%x", dev.BDF, bridge.ID, slot)
+}
+
+// vfioHotplugArgs builds the QMP device_add arguments used to attach dev
+// at runtime, on the bridge/slot allocated for it. The "id" is set to
+// dev.BDF so that a later device_del can reference the same device.
+func vfioHotplugArgs(dev VFIODevice, bridge *Bridge, slot int) map[string]interface{} {
+	return map[string]interface{}{
+		"driver": "vfio-pci",
+		"id":     dev.BDF,
+		"host":   dev.BDF,
+		"bus":    bridge.ID,
+		"addr":   fmt.Sprintf("0x%x", slot),
+	}
+}
@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSysfs builds a minimal fake sysfs tree under t.TempDir() and points
+// sysBusPCIDevices/sysKernelIOMMUGroups at it for the duration of the
+// test.
+func fakeSysfs(t *testing.T) (busDir, groupsDir string) {
+	t.Helper()
+
+	root := t.TempDir()
+	busDir = filepath.Join(root, "bus", "pci", "devices")
+	groupsDir = filepath.Join(root, "kernel", "iommu_groups")
+
+	if err := os.MkdirAll(busDir, 0755); err != nil {
+		t.Fatalf("unable to create fake sysfs bus dir: %s", err)
+	}
+	if err := os.MkdirAll(groupsDir, 0755); err != nil {
+		t.Fatalf("unable to create fake sysfs groups dir: %s", err)
+	}
+
+	origBus, origGroups := sysBusPCIDevices, sysKernelIOMMUGroups
+	sysBusPCIDevices, sysKernelIOMMUGroups = busDir, groupsDir
+	t.Cleanup(func() {
+		sysBusPCIDevices, sysKernelIOMMUGroups = origBus, origGroups
+	})
+
+	return busDir, groupsDir
+}
+
+// addFakeDevice creates busDir/<bdf> with an iommu_group symlink into
+// group, vendor/device attribute files, a driver_override file, and
+// (optionally) a driver symlink to driverName.
+func addFakeDevice(t *testing.T, busDir, groupsDir, bdf string, group int, driverName string) {
+	t.Helper()
+
+	devPath := filepath.Join(busDir, bdf)
+	if err := os.MkdirAll(devPath, 0755); err != nil {
+		t.Fatalf("unable to create fake device dir: %s", err)
+	}
+
+	groupPath := filepath.Join(groupsDir, itoa(group))
+	if err := os.MkdirAll(filepath.Join(groupPath, "devices"), 0755); err != nil {
+		t.Fatalf("unable to create fake iommu group dir: %s", err)
+	}
+
+	if err := os.Symlink(groupPath, filepath.Join(devPath, "iommu_group")); err != nil {
+		t.Fatalf("unable to symlink iommu_group: %s", err)
+	}
+
+	if err := os.Symlink(devPath, filepath.Join(groupPath, "devices", bdf)); err != nil {
+		t.Fatalf("unable to register device under its iommu group: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(devPath, "vendor"), []byte("0x8086\n"), 0644); err != nil {
+		t.Fatalf("unable to write fake vendor attribute: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(devPath, "device"), []byte("0x1521\n"), 0644); err != nil {
+		t.Fatalf("unable to write fake device attribute: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(devPath, "driver_override"), []byte(""), 0644); err != nil {
+		t.Fatalf("unable to create fake driver_override: %s", err)
+	}
+
+	if driverName != "" {
+		root := filepath.Dir(filepath.Dir(filepath.Dir(busDir)))
+		driversDir := filepath.Join(root, "bus", "pci", "drivers", driverName)
+		if err := os.MkdirAll(driversDir, 0755); err != nil {
+			t.Fatalf("unable to create fake driver dir: %s", err)
+		}
+		if err := os.Symlink(driversDir, filepath.Join(devPath, "driver")); err != nil {
+			t.Fatalf("unable to symlink driver: %s", err)
+		}
+	}
+}
+
+func itoa(i int) string {
+	if i == 0 {
+		return "0"
+	}
+	digits := ""
+	for i > 0 {
+		digits = string(rune('0'+i%10)) + digits
+		i /= 10
+	}
+	return digits
+}
+
+func TestResolveVFIODeviceSingleDeviceGroup(t *testing.T) {
+	busDir, groupsDir := fakeSysfs(t)
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.0", 5, "")
+
+	dev, err := resolveVFIODevice("0000:00:02.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if dev.IOMMUGroup != 5 {
+		t.Fatalf("expected IOMMU group 5, got %d", dev.IOMMUGroup)
+	}
+	if dev.VendorID != 0x8086 {
+		t.Fatalf("expected vendor ID 0x8086, got 0x%x", dev.VendorID)
+	}
+	if dev.DeviceID != 0x1521 {
+		t.Fatalf("expected device ID 0x1521, got 0x%x", dev.DeviceID)
+	}
+}
+
+func TestResolveVFIODeviceMultiDeviceGroupAllIsolated(t *testing.T) {
+	busDir, groupsDir := fakeSysfs(t)
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.0", 5, "vfio-pci")
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.1", 5, "vfio-pci")
+
+	if _, err := resolveVFIODevice("0000:00:02.0"); err != nil {
+		t.Fatalf("expected a fully vfio-pci-bound group to resolve cleanly, got: %s", err)
+	}
+}
+
+func TestResolveVFIODeviceMultiDeviceGroupNotIsolated(t *testing.T) {
+	busDir, groupsDir := fakeSysfs(t)
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.0", 5, "")
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.1", 5, "e1000e")
+
+	if _, err := resolveVFIODevice("0000:00:02.0"); err == nil {
+		t.Fatal("expected an error when a sibling device in the same IOMMU group is bound to a non-vfio-pci driver")
+	}
+}
+
+func TestResolveVFIODeviceMissingDriverOverride(t *testing.T) {
+	busDir, groupsDir := fakeSysfs(t)
+	addFakeDevice(t, busDir, groupsDir, "0000:00:02.0", 5, "")
+
+	if err := os.Remove(filepath.Join(busDir, "0000:00:02.0", "driver_override")); err != nil {
+		t.Fatalf("unable to remove fake driver_override: %s", err)
+	}
+
+	_, err := resolveVFIODevice("0000:00:02.0")
+	if err == nil {
+		t.Fatal("expected an error when driver_override is missing")
+	}
+}
+
+func TestVfioHotplugArgsIDMatchesBDF(t *testing.T) {
+	dev := VFIODevice{BDF: "0000:00:02.0"}
+	bridge := newBridge(pciBridge, "pci-bridge-0")
+
+	args := vfioHotplugArgs(dev, &bridge, 1)
+
+	if args["id"] != dev.BDF {
+		t.Fatalf("expected id %q to match the device's BDF so device_del can reference it, got %v", dev.BDF, args["id"])
+	}
+	if args["host"] != dev.BDF {
+		t.Fatalf("expected host %q, got %v", dev.BDF, args["host"])
+	}
+}
+
+func TestResolveVFIODeviceMissingIOMMUGroup(t *testing.T) {
+	busDir, _ := fakeSysfs(t)
+
+	devPath := filepath.Join(busDir, "0000:00:02.0")
+	if err := os.MkdirAll(devPath, 0755); err != nil {
+		t.Fatalf("unable to create fake device dir: %s", err)
+	}
+
+	if _, err := resolveVFIODevice("0000:00:02.0"); err == nil {
+		t.Fatal("expected an error when the device has no iommu_group link")
+	}
+}
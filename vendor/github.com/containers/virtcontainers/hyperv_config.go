@@ -0,0 +1,35 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+// HyperVConfig holds the Hyper-V specific knobs that only make sense for
+// the hyperv HypervisorType. It is kept platform-agnostic so that
+// HypervisorConfig can embed it regardless of the host OS the package is
+// built for.
+type HyperVConfig struct {
+	// SwitchName is the name of the Hyper-V virtual switch the pod's
+	// synthetic network adapters are connected to.
+	SwitchName string
+
+	// Generation selects the Hyper-V virtual machine generation (1 or
+	// 2). Generation 2 is required for secure boot.
+	Generation int
+
+	// SecureBoot enables UEFI secure boot on the virtual machine. Only
+	// valid with Generation 2.
+	SecureBoot bool
+}
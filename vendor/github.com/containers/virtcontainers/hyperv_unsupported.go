@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build !windows
+
+package virtcontainers
+
+import "fmt"
+
+// hyperv is a stub implementation of the HyperVHypervisor backend for
+// platforms other than Windows, where the Hyper-V WMI namespace this
+// backend relies on does not exist.
+type hyperv struct {
+	config HypervisorConfig
+}
+
+var errHyperVUnsupported = fmt.Errorf("Hyper-V hypervisor is only supported on Windows hosts")
+
+func (h *hyperv) init(config HypervisorConfig) error {
+	h.config = config
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) createPod(podConfig PodConfig) error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) startPod(startCh, stopCh chan struct{}) error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) stopPod() error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) pausePod() error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) resumePod() error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) addDevice(devInfo interface{}, devType deviceType) error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) hotplugAddDevice(devInfo interface{}, devType deviceType) error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) hotplugRemoveDevice(devInfo interface{}, devType deviceType) error {
+	return errHyperVUnsupported
+}
+
+func (h *hyperv) getPodConsole(podID string) string {
+	return ""
+}
+
+func (h *hyperv) capabilities() capabilities {
+	return capabilities{}
+}
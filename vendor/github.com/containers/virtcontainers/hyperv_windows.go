@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build windows
+
+package virtcontainers
+
+import (
+	"fmt"
+
+	"github.com/ipaste/libhvee/pkg/wmi"
+)
+
+// hyperv is a Hyper-V hypervisor backend driven through WMI, talking to
+// the virtualization infrastructure management service directly instead
+// of shelling out to PowerShell.
+type hyperv struct {
+	config HypervisorConfig
+	client *wmi.Client
+
+	systemSettings    *wmi.Msvm_VirtualSystemSettingData
+	processorSettings *wmi.Msvm_ProcessorSettingData
+	memorySettings    *wmi.Msvm_MemorySettingData
+
+	podID string
+}
+
+func (h *hyperv) init(config HypervisorConfig) error {
+	valid, err := config.valid()
+	if !valid {
+		return err
+	}
+
+	client, err := wmi.NewClient()
+	if err != nil {
+		return fmt.Errorf("Unable to connect to the Hyper-V WMI namespace: %s", err)
+	}
+
+	h.config = config
+	h.client = client
+
+	return nil
+}
+
+func (h *hyperv) createPod(podConfig PodConfig) error {
+	h.podID = podConfig.ID
+
+	generation := h.config.HyperV.Generation
+	if generation == 0 {
+		generation = 1
+	}
+
+	h.systemSettings = &wmi.Msvm_VirtualSystemSettingData{
+		ElementName:          podConfig.ID,
+		VirtualSystemType:    "Microsoft:Hyper-V:System:Realized",
+		VirtualSystemSubType: fmt.Sprintf("Microsoft:Hyper-V:SubType:%d", generation),
+		SecureBootEnabled:    h.config.HyperV.SecureBoot,
+	}
+
+	h.processorSettings = &wmi.Msvm_ProcessorSettingData{
+		VirtualQuantity: h.config.DefaultVCPUs,
+	}
+
+	h.memorySettings = &wmi.Msvm_MemorySettingData{
+		VirtualQuantity:      uint64(h.config.DefaultMemSz),
+		DynamicMemoryEnabled: !h.config.MemPrealloc,
+	}
+
+	if err := h.client.DefineSystem(h.systemSettings, h.processorSettings, h.memorySettings); err != nil {
+		return fmt.Errorf("Unable to define Hyper-V virtual machine %s: %s", podConfig.ID, err)
+	}
+
+	if err := h.addStorage(podConfig); err != nil {
+		return err
+	}
+
+	if err := h.addNetwork(podConfig); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addStorage attaches a synthetic SCSI controller and the guest image at
+// ImagePath as a VHDX drive. Block devices are not attached here; they go
+// through addDevice.
+func (h *hyperv) addStorage(podConfig PodConfig) error {
+	scsiController := &wmi.Msvm_ResourceAllocationSettingData{
+		ResourceSubType: "Microsoft:Hyper-V:Synthetic SCSI Controller",
+	}
+
+	drive := &wmi.Msvm_ResourceAllocationSettingData{
+		ResourceSubType: "Microsoft:Hyper-V:Synthetic Disk Drive",
+		HostResource:    []string{h.config.ImagePath},
+	}
+
+	return h.client.AddResources(h.systemSettings, scsiController, drive)
+}
+
+// addNetwork attaches a synthetic Ethernet port connected to the
+// configured Hyper-V switch.
+func (h *hyperv) addNetwork(podConfig PodConfig) error {
+	if h.config.HyperV.SwitchName == "" {
+		return nil
+	}
+
+	port := &wmi.Msvm_SyntheticEthernetPortSettingData{
+		ElementName: fmt.Sprintf("%s-eth0", podConfig.ID),
+	}
+
+	return h.client.ConnectToSwitch(h.systemSettings, port, h.config.HyperV.SwitchName)
+}
+
+func (h *hyperv) startPod(startCh, stopCh chan struct{}) error {
+	return h.client.RequestStateChange(h.systemSettings, wmi.RequestedStateEnabled)
+}
+
+func (h *hyperv) stopPod() error {
+	return h.client.RequestStateChange(h.systemSettings, wmi.RequestedStateDisabled)
+}
+
+func (h *hyperv) pausePod() error {
+	return h.client.RequestStateChange(h.systemSettings, wmi.RequestedStatePaused)
+}
+
+func (h *hyperv) resumePod() error {
+	return h.client.RequestStateChange(h.systemSettings, wmi.RequestedStateEnabled)
+}
+
+func (h *hyperv) addDevice(devInfo interface{}, devType deviceType) error {
+	switch devType {
+	case netDev, blockDev, imgDev:
+		rs, ok := devInfo.(wmi.SettingData)
+		if !ok {
+			return fmt.Errorf("Unsupported device settings type for Hyper-V: %T", devInfo)
+		}
+		return h.client.AddResources(h.systemSettings, rs)
+	default:
+		return fmt.Errorf("Unsupported device type for Hyper-V: %v", devType)
+	}
+}
+
+func (h *hyperv) hotplugAddDevice(devInfo interface{}, devType deviceType) error {
+	return h.addDevice(devInfo, devType)
+}
+
+func (h *hyperv) hotplugRemoveDevice(devInfo interface{}, devType deviceType) error {
+	rs, ok := devInfo.(wmi.SettingData)
+	if !ok {
+		return fmt.Errorf("Unsupported device settings type for Hyper-V: %T", devInfo)
+	}
+	return h.client.RemoveResources(h.systemSettings, rs)
+}
+
+func (h *hyperv) getPodConsole(podID string) string {
+	return fmt.Sprintf(`\\.\pipe\%s-kvp`, podID)
+}
+
+func (h *hyperv) capabilities() capabilities {
+	return capabilities{}
+}
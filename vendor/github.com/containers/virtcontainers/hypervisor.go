@@ -33,6 +33,10 @@ const (
 
 	// MockHypervisor is a mock hypervisor for testing purposes
 	MockHypervisor HypervisorType = "mock"
+
+	// HyperVHypervisor is the Hyper-V hypervisor, available on Windows
+	// hosts.
+	HyperVHypervisor HypervisorType = "hyperv"
 )
 
 const (
@@ -84,6 +88,9 @@ func (hType *HypervisorType) Set(value string) error {
 	case "mock":
 		*hType = MockHypervisor
 		return nil
+	case "hyperv":
+		*hType = HyperVHypervisor
+		return nil
 	default:
 		return fmt.Errorf("Unknown hypervisor type %s", value)
 	}
@@ -96,6 +103,8 @@ func (hType *HypervisorType) String() string {
 		return string(QemuHypervisor)
 	case MockHypervisor:
 		return string(MockHypervisor)
+	case HyperVHypervisor:
+		return string(HyperVHypervisor)
 	default:
 		return ""
 	}
@@ -108,6 +117,8 @@ func newHypervisor(hType HypervisorType) (hypervisor, error) {
 		return &qemu{}, nil
 	case MockHypervisor:
 		return &mockHypervisor{}, nil
+	case HyperVHypervisor:
+		return &hyperv{}, nil
 	default:
 		return nil, fmt.Errorf("Unknown hypervisor type %s", hType)
 	}
@@ -134,10 +145,10 @@ type HypervisorConfig struct {
 	DisableBlockDeviceUse bool
 
 	// KernelParams are additional guest kernel parameters.
-	KernelParams []Param
+	KernelParams ParamSet
 
 	// HypervisorParams are additional hypervisor parameters.
-	HypervisorParams []Param
+	HypervisorParams ParamSet
 
 	// HypervisorMachineType specifies the type of machine being
 	// emulated.
@@ -172,6 +183,30 @@ type HypervisorConfig struct {
 	// DisableNestingChecks is used to override customizations performed
 	// when running on top of another VMM.
 	DisableNestingChecks bool
+
+	// DefaultBridges specifies the number of PCI/PCIe bridges attached
+	// to the guest machine. Extra bridges allow hot-plug to keep
+	// working past the small number of root ports a machine type
+	// exposes natively (e.g. q35). Capped at maxBridges.
+	DefaultBridges uint32
+
+	// HyperV holds the configuration specific to the HyperVHypervisor
+	// backend. It is ignored by other hypervisor types.
+	HyperV HyperVConfig
+
+	// VFIOMode selects how VFIO device passthrough is made available to
+	// the guest and is reported through capabilities(). Defaults to
+	// VFIOModeDisabled. See VFIOMode for what the qemu backend checks.
+	VFIOMode VFIOMode
+
+	// CloudInit carries the cloud-init documents used to seed the
+	// guest image, when set.
+	CloudInit CloudInitConfig
+
+	// OVFEnvironment is an OVF environment XML property blob injected
+	// as a second read-only CD-ROM, for guest images that expect OVF
+	// transport instead of (or alongside) cloud-init.
+	OVFEnvironment []byte
 }
 
 func (conf *HypervisorConfig) valid() (bool, error) {
@@ -191,66 +226,31 @@ func (conf *HypervisorConfig) valid() (bool, error) {
 		conf.DefaultMemSz = defaultMemSzMiB
 	}
 
+	if conf.DefaultBridges == 0 {
+		conf.DefaultBridges = defaultBridges
+	}
+
+	if conf.DefaultBridges > maxBridges {
+		conf.DefaultBridges = maxBridges
+	}
+
 	return true, nil
 }
 
 // AddKernelParam allows the addition of new kernel parameters to an existing
-// hypervisor configuration.
+// hypervisor configuration. Kernel parameters may legitimately repeat
+// (e.g. "console="), so this adds p rather than replacing any existing
+// value for the same key; use conf.KernelParams.Set to replace instead.
 func (conf *HypervisorConfig) AddKernelParam(p Param) error {
 	if p.Key == "" {
 		return fmt.Errorf("Empty kernel parameter")
 	}
 
-	conf.KernelParams = append(conf.KernelParams, p)
+	conf.KernelParams.Add(p.Key, p.Value)
 
 	return nil
 }
 
-func appendParam(params []Param, parameter string, value string) []Param {
-	return append(params, Param{parameter, value})
-}
-
-// SerializeParams converts []Param to []string
-func SerializeParams(params []Param, delim string) []string {
-	var parameters []string
-
-	for _, p := range params {
-		if p.Key == "" && p.Value == "" {
-			continue
-		} else if p.Key == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.Value))
-		} else if p.Value == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.Key))
-		} else if delim == "" {
-			parameters = append(parameters, fmt.Sprintf("%s", p.Key))
-			parameters = append(parameters, fmt.Sprintf("%s", p.Value))
-		} else {
-			parameters = append(parameters, fmt.Sprintf("%s%s%s", p.Key, delim, p.Value))
-		}
-	}
-
-	return parameters
-}
-
-// DeserializeParams converts []string to []Param
-func DeserializeParams(parameters []string) []Param {
-	var params []Param
-
-	for _, param := range parameters {
-		if param == "" {
-			continue
-		}
-		p := strings.SplitN(param, "=", 2)
-		if len(p) == 2 {
-			params = append(params, Param{Key: p[0], Value: p[1]})
-		} else {
-			params = append(params, Param{Key: p[0], Value: ""})
-		}
-	}
-
-	return params
-}
-
 func getHostMemorySizeKb(memInfoPath string) (uint64, error) {
 	f, err := os.Open(memInfoPath)
 	if err != nil {
@@ -284,48 +284,6 @@ func getHostMemorySizeKb(memInfoPath string) (uint64, error) {
 	return 0, fmt.Errorf("unable get MemTotal from %s", memInfoPath)
 }
 
-// RunningOnVMM checks if the system is running inside a VM.
-func RunningOnVMM(cpuInfoPath string) (bool, error) {
-	flagsField := "flags"
-
-	f, err := os.Open(cpuInfoPath)
-	if err != nil {
-		return false, err
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		// Expected format: ["flags", ":", ...] or ["flags:", ...]
-		fields := strings.Fields(scanner.Text())
-		if len(fields) < 2 {
-			continue
-		}
-
-		if !strings.HasPrefix(fields[0], flagsField) {
-			continue
-		}
-
-		for _, field := range fields[1:] {
-			if field == "hypervisor" {
-				return true, nil
-			}
-		}
-
-		// As long as we have been able to analyze the fields from
-		// "flags", there is no reason to check what comes next from
-		// /proc/cpuinfo, because we already know we are not running
-		// on a VMM.
-		return false, nil
-	}
-
-	if err := scanner.Err(); err != nil {
-		return false, err
-	}
-
-	return false, fmt.Errorf("Couldn't find %q from %q output", flagsField, cpuInfoPath)
-}
-
 // hypervisor is the virtcontainers hypervisor interface.
 // The default hypervisor implementation is Qemu.
 type hypervisor interface {
@@ -0,0 +1,252 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import "strings"
+
+// MergePolicy controls how ParamSet.Merge resolves a key present in both
+// sets.
+type MergePolicy int
+
+const (
+	// Override replaces any existing value for a key with the other
+	// set's value. Used when layering higher precedence parameters
+	// (e.g. user params) on top of lower precedence ones.
+	Override MergePolicy = iota
+
+	// KeepFirst keeps the receiver's existing value for a key,
+	// ignoring the other set's value for it. Used when the receiver
+	// already holds the higher precedence parameters.
+	KeepFirst
+
+	// Append keeps both values, in order, instead of deduplicating the
+	// key. Used for parameters that legitimately repeat, such as
+	// "console=".
+	Append
+)
+
+// ParamSet is an ordered collection of kernel or hypervisor parameters
+// that tracks which keys are already present, so that merging parameters
+// coming from different sources (defaults, image-bundled data, user
+// overrides) does not silently produce duplicate or conflicting entries.
+//
+// The zero value is an empty, usable ParamSet.
+type ParamSet struct {
+	entries []Param
+	index   map[string][]int
+	frozen  bool
+}
+
+// NewParamSet builds a ParamSet from an ordered list of parameters,
+// preserving duplicate keys exactly as DeserializeParams would.
+func NewParamSet(params ...Param) ParamSet {
+	var p ParamSet
+	for _, param := range params {
+		p.Add(param.Key, param.Value)
+	}
+
+	return p
+}
+
+// ensureIndex lazily allocates the index map, since the zero value of
+// ParamSet has a nil one.
+func (p *ParamSet) ensureIndex() {
+	if p.index == nil {
+		p.index = make(map[string][]int)
+	}
+}
+
+// Set assigns value to key, replacing every existing entry for key with a
+// single one at the position of its first occurrence (or appending a new
+// entry if key was not present). Use Set for parameters that must not
+// repeat, such as "root=".
+func (p *ParamSet) Set(key, value string) {
+	if p.frozen {
+		return
+	}
+
+	p.ensureIndex()
+
+	indices := p.index[key]
+	if len(indices) == 0 {
+		p.entries = append(p.entries, Param{Key: key, Value: value})
+		p.index[key] = []int{len(p.entries) - 1}
+		return
+	}
+
+	p.entries[indices[0]].Value = value
+
+	if len(indices) > 1 {
+		p.removeIndices(indices[1:])
+		p.index[key] = []int{indices[0]}
+	}
+}
+
+// Add appends a new entry for key without touching any existing entries
+// for it. Use Add for parameters that legitimately repeat, such as
+// "console=".
+func (p *ParamSet) Add(key, value string) {
+	if p.frozen {
+		return
+	}
+
+	p.ensureIndex()
+
+	p.entries = append(p.entries, Param{Key: key, Value: value})
+	p.index[key] = append(p.index[key], len(p.entries)-1)
+}
+
+// Remove deletes every entry for key, if any.
+func (p *ParamSet) Remove(key string) {
+	if p.frozen {
+		return
+	}
+
+	indices, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	p.removeIndices(indices)
+	delete(p.index, key)
+}
+
+// removeIndices deletes the entries at the given indices (assumed sorted
+// ascending, as produced by append order) and rebuilds the index.
+func (p *ParamSet) removeIndices(indices []int) {
+	remove := make(map[int]struct{}, len(indices))
+	for _, i := range indices {
+		remove[i] = struct{}{}
+	}
+
+	kept := p.entries[:0:0]
+	for i, entry := range p.entries {
+		if _, drop := remove[i]; drop {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	p.entries = kept
+	p.index = nil
+	p.ensureIndex()
+	for i, entry := range p.entries {
+		p.index[entry.Key] = append(p.index[entry.Key], i)
+	}
+}
+
+// Merge combines other into a copy of p according to policy and returns
+// the result, leaving both p and other untouched:
+//
+//   - Override: other's value for a repeated key replaces p's.
+//   - KeepFirst: p's existing value for a key is kept, other's is dropped.
+//   - Append: every entry from other is appended after p's, duplicates
+//     included.
+func (p ParamSet) Merge(other ParamSet, policy MergePolicy) ParamSet {
+	result := NewParamSet(p.entries...)
+
+	// hadKey records which keys p already held before merging, so that
+	// KeepFirst can tell "p already has this key, drop other's entry"
+	// apart from "other introduced this key, keep all of its entries for
+	// it" even after the first of several same-key entries from other
+	// has been copied into result.
+	hadKey := make(map[string]bool, len(p.index))
+	for key := range p.index {
+		hadKey[key] = true
+	}
+
+	for _, entry := range other.entries {
+		switch policy {
+		case KeepFirst:
+			if !hadKey[entry.Key] {
+				result.Add(entry.Key, entry.Value)
+			}
+		case Append:
+			result.Add(entry.Key, entry.Value)
+		default: // Override
+			result.Set(entry.Key, entry.Value)
+		}
+	}
+
+	return result
+}
+
+// List returns the ParamSet's entries in order. The returned slice is a
+// copy; mutating it does not affect the ParamSet.
+func (p ParamSet) List() []Param {
+	out := make([]Param, len(p.entries))
+	copy(out, p.entries)
+	return out
+}
+
+// Freeze returns an immutable snapshot of p. Further calls to Set, Add or
+// Remove on the returned ParamSet are no-ops.
+func (p ParamSet) Freeze() ParamSet {
+	frozen := NewParamSet(p.entries...)
+	frozen.frozen = true
+	return frozen
+}
+
+// SerializeParams converts a ParamSet to []string, one entry per
+// parameter, joined by delim when both a key and a value are present.
+//
+// Kept as a compatibility shim for callers that still deal in []string
+// command line fragments; prefer ParamSet's own methods when building or
+// merging parameters.
+func SerializeParams(params ParamSet, delim string) []string {
+	var parameters []string
+
+	for _, p := range params.List() {
+		if p.Key == "" && p.Value == "" {
+			continue
+		} else if p.Key == "" {
+			parameters = append(parameters, p.Value)
+		} else if p.Value == "" {
+			parameters = append(parameters, p.Key)
+		} else if delim == "" {
+			parameters = append(parameters, p.Key)
+			parameters = append(parameters, p.Value)
+		} else {
+			parameters = append(parameters, p.Key+delim+p.Value)
+		}
+	}
+
+	return parameters
+}
+
+// DeserializeParams converts []string to a ParamSet, splitting each entry
+// on the first "=". Entries without a "=" become key-only parameters.
+//
+// Kept as a compatibility shim; see SerializeParams.
+func DeserializeParams(parameters []string) ParamSet {
+	var params ParamSet
+
+	for _, parameter := range parameters {
+		if parameter == "" {
+			continue
+		}
+
+		p := strings.SplitN(parameter, "=", 2)
+		if len(p) == 2 {
+			params.Add(p[0], p[1])
+		} else {
+			params.Add(p[0], "")
+		}
+	}
+
+	return params
+}
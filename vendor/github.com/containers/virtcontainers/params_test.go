@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParamSetSetReplacesExistingValue(t *testing.T) {
+	var p ParamSet
+	p.Set("root", "/dev/vda1")
+	p.Set("root", "/dev/vda2")
+
+	got := p.List()
+	want := []Param{{Key: "root", Value: "/dev/vda2"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetAddAllowsConsoleRepetition(t *testing.T) {
+	var p ParamSet
+	p.Add("console", "ttyS0")
+	p.Add("console", "hvc0")
+
+	got := p.List()
+	want := []Param{
+		{Key: "console", Value: "ttyS0"},
+		{Key: "console", Value: "hvc0"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetRemove(t *testing.T) {
+	var p ParamSet
+	p.Add("console", "ttyS0")
+	p.Set("quiet", "")
+	p.Remove("console")
+
+	got := p.List()
+	want := []Param{{Key: "quiet", Value: ""}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetMergeOverride(t *testing.T) {
+	base := NewParamSet(Param{Key: "root", Value: "/dev/vda1"})
+	override := NewParamSet(Param{Key: "root", Value: "/dev/vda2"})
+
+	merged := base.Merge(override, Override)
+
+	got := merged.List()
+	want := []Param{{Key: "root", Value: "/dev/vda2"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetMergeKeepFirst(t *testing.T) {
+	base := NewParamSet(Param{Key: "root", Value: "/dev/vda1"})
+	other := NewParamSet(Param{Key: "root", Value: "/dev/vda2"}, Param{Key: "quiet", Value: ""})
+
+	merged := base.Merge(other, KeepFirst)
+
+	got := merged.List()
+	want := []Param{
+		{Key: "root", Value: "/dev/vda1"},
+		{Key: "quiet", Value: ""},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetMergeKeepFirstPreservesRepeatedNewKey(t *testing.T) {
+	base := NewParamSet(Param{Key: "root", Value: "/dev/vda1"})
+	other := NewParamSet(Param{Key: "console", Value: "ttyS0"}, Param{Key: "console", Value: "hvc0"})
+
+	merged := base.Merge(other, KeepFirst)
+
+	got := merged.List()
+	want := []Param{
+		{Key: "root", Value: "/dev/vda1"},
+		{Key: "console", Value: "ttyS0"},
+		{Key: "console", Value: "hvc0"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetMergeAppendPreservesRepeatedKeys(t *testing.T) {
+	base := NewParamSet(Param{Key: "console", Value: "ttyS0"})
+	other := NewParamSet(Param{Key: "console", Value: "hvc0"})
+
+	merged := base.Merge(other, Append)
+
+	got := merged.List()
+	want := []Param{
+		{Key: "console", Value: "ttyS0"},
+		{Key: "console", Value: "hvc0"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParamSetFreezeIgnoresMutations(t *testing.T) {
+	p := NewParamSet(Param{Key: "root", Value: "/dev/vda1"})
+	frozen := p.Freeze()
+
+	frozen.Set("root", "/dev/vda2")
+	frozen.Add("console", "ttyS0")
+	frozen.Remove("root")
+
+	got := frozen.List()
+	want := []Param{{Key: "root", Value: "/dev/vda1"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected a frozen ParamSet to reject mutation, got %#v want %#v", got, want)
+	}
+}
+
+func TestSerializeParamsDelimiterVariations(t *testing.T) {
+	params := NewParamSet(
+		Param{Key: "root", Value: "/dev/vda1"},
+		Param{Key: "quiet", Value: ""},
+		Param{Key: "", Value: "standalone"},
+	)
+
+	got := SerializeParams(params, "=")
+	want := []string{"root=/dev/vda1", "quiet", "standalone"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("delim=\"=\": got %#v, want %#v", got, want)
+	}
+
+	got = SerializeParams(params, "")
+	want = []string{"root", "/dev/vda1", "quiet", "standalone"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("delim=\"\": got %#v, want %#v", got, want)
+	}
+}
+
+func TestDeserializeParamsConsoleRepetitionAndKeyOnly(t *testing.T) {
+	params := DeserializeParams([]string{
+		"console=ttyS0",
+		"console=hvc0",
+		"quiet",
+		"",
+	})
+
+	got := params.List()
+	want := []Param{
+		{Key: "console", Value: "ttyS0"},
+		{Key: "console", Value: "hvc0"},
+		{Key: "quiet", Value: ""},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
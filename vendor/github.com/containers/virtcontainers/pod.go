@@ -0,0 +1,28 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+// PodConfig identifies the pod a hypervisor backend's createPod call is
+// bringing up. It is kept separate from HypervisorConfig, which only
+// carries settings shared by every pod a given hypervisor instance might
+// run.
+type PodConfig struct {
+	// ID uniquely identifies the pod. Backends use it to name the
+	// virtual machine and any resources created on its behalf (e.g.
+	// "<ID>-eth0").
+	ID string
+}
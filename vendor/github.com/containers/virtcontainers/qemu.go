@@ -0,0 +1,361 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qemuMachineTypeDefault is the machine type used when
+// HypervisorConfig.HypervisorMachineType is left empty.
+const qemuMachineTypeDefault = "pc"
+
+// qemuMachineTypeQ35 is the machine type that requires PCIe bridges
+// instead of conventional PCI ones.
+const qemuMachineTypeQ35 = "q35"
+
+// qemuDialTimeout bounds how long startPod waits for the QMP socket to
+// come up after the QEMU process has been started.
+const qemuDialTimeout = 5 * time.Second
+
+// qemuDialInterval is how often startPod retries connecting to the QMP
+// socket while waiting for it to appear.
+const qemuDialInterval = 50 * time.Millisecond
+
+// qemu is the default hypervisor backend, driving a QEMU process through
+// its command line at boot and through QMP (see qmp.go) for hot-plug and
+// lifecycle operations once it is running.
+type qemu struct {
+	config HypervisorConfig
+
+	podID    string
+	runDir   string
+	bridges  []Bridge
+	bootArgs []string
+
+	consolePath string
+	qmpSockPath string
+
+	cmd *exec.Cmd
+	qmp *qmpClient
+}
+
+func (q *qemu) init(config HypervisorConfig) error {
+	valid, err := config.valid()
+	if !valid {
+		return err
+	}
+
+	if err := ValidateHostCPUConstraints(&config); err != nil {
+		return err
+	}
+
+	q.config = config
+
+	return nil
+}
+
+// machineType returns the configured QEMU machine type, defaulting to
+// "pc" when none was set.
+func (q *qemu) machineType() string {
+	if q.config.HypervisorMachineType != "" {
+		return q.config.HypervisorMachineType
+	}
+
+	return qemuMachineTypeDefault
+}
+
+// bridgeType returns the bridge type matching the configured machine
+// type: PCIe bridges for q35, conventional PCI bridges otherwise.
+func (q *qemu) bridgeType() bridgeType {
+	if q.machineType() == qemuMachineTypeQ35 {
+		return pcieBridge
+	}
+
+	return pciBridge
+}
+
+// qemuDefaultKernelParams returns the kernel parameters this backend
+// boots with in the absence of any user-supplied ones. HypervisorConfig's
+// own KernelParams are layered on top through ParamSet.Merge with the
+// Override policy, so a user-supplied value always wins over a default
+// for the same key.
+func qemuDefaultKernelParams() ParamSet {
+	var params ParamSet
+	params.Add("console", "hvc0")
+	params.Add("reboot", "k")
+	params.Add("panic", "1")
+	params.Add("quiet", "")
+	return params
+}
+
+func (q *qemu) createPod(podConfig PodConfig) error {
+	q.podID = podConfig.ID
+	q.bridges = newBridges(q.config.DefaultBridges, q.bridgeType())
+
+	runDir := filepath.Join(os.TempDir(), "virtcontainers", q.podID)
+	if err := os.MkdirAll(runDir, 0700); err != nil {
+		return fmt.Errorf("Unable to create run directory for pod %s: %s", q.podID, err)
+	}
+	q.runDir = runDir
+	q.qmpSockPath = filepath.Join(runDir, "qmp.sock")
+	q.consolePath = filepath.Join(runDir, "console.sock")
+
+	args := []string{
+		"-machine", q.machineType(),
+		"-kernel", q.config.KernelPath,
+		"-m", strconv.FormatUint(uint64(q.config.DefaultMemSz), 10),
+		"-smp", strconv.FormatUint(uint64(q.config.DefaultVCPUs), 10),
+		"-drive", fmt.Sprintf("file=%s,if=%s", q.config.ImagePath, q.imageDriveInterface()),
+		"-chardev", fmt.Sprintf("socket,id=console,path=%s,server,nowait", q.consolePath),
+		"-device", "virtconsole,chardev=console",
+	}
+
+	for i := range q.bridges {
+		args = append(args, q.bridges[i].qemuArgs(i)...)
+	}
+
+	if q.config.CloudInit.enabled() {
+		seedPath, err := q.config.CloudInit.generateSeedISO(q.runDir)
+		if err != nil {
+			return fmt.Errorf("Unable to generate cloud-init seed image for pod %s: %s", q.podID, err)
+		}
+		args = append(args, "-drive", cdromDriveArg(seedPath))
+
+		if err := q.config.AddKernelParam(q.config.CloudInit.kernelParam()); err != nil {
+			return err
+		}
+	}
+
+	if len(q.config.OVFEnvironment) > 0 {
+		ovfPath, err := writeOVFEnvironment(q.runDir, q.config.OVFEnvironment)
+		if err != nil {
+			return fmt.Errorf("Unable to write OVF environment for pod %s: %s", q.podID, err)
+		}
+		args = append(args, "-drive", cdromDriveArg(ovfPath))
+	}
+
+	kernelParams := qemuDefaultKernelParams().Merge(q.config.KernelParams, Override).Freeze()
+	if appended := SerializeParams(kernelParams, "="); len(appended) > 0 {
+		args = append(args, "-append", strings.Join(appended, " "))
+	}
+
+	for _, hp := range q.config.HypervisorParams.List() {
+		args = append(args, hp.Key)
+		if hp.Value != "" {
+			args = append(args, hp.Value)
+		}
+	}
+
+	args = append(args, "-qmp", fmt.Sprintf("unix:%s,server,nowait", q.qmpSockPath))
+
+	q.bootArgs = args
+
+	return nil
+}
+
+// imageDriveInterface returns the "-drive if=..." value matching
+// DisableBlockDeviceUse: virtio when block devices are allowed, plain IDE
+// emulation otherwise.
+func (q *qemu) imageDriveInterface() string {
+	if q.config.DisableBlockDeviceUse {
+		return "ide"
+	}
+
+	return "virtio"
+}
+
+func (q *qemu) startPod(startCh, stopCh chan struct{}) error {
+	hypervisorPath := q.config.HypervisorPath
+	if hypervisorPath == "" {
+		hypervisorPath = "qemu-system-x86_64"
+	}
+
+	cmd := exec.Command(hypervisorPath, q.bootArgs...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Unable to start QEMU for pod %s: %s", q.podID, err)
+	}
+	q.cmd = cmd
+
+	qmp, err := q.dialQMP()
+	if err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	q.qmp = qmp
+
+	if startCh != nil {
+		close(startCh)
+	}
+
+	if stopCh != nil {
+		go func() {
+			<-stopCh
+			q.stopPod()
+		}()
+	}
+
+	return nil
+}
+
+// dialQMP connects to the QMP socket createPod configured QEMU to listen
+// on, retrying until qemuDialTimeout since the socket is not guaranteed to
+// exist the instant the process starts.
+func (q *qemu) dialQMP() (*qmpClient, error) {
+	deadline := time.Now().Add(qemuDialTimeout)
+
+	var lastErr error
+	for time.Now().Before(deadline) {
+		client, err := newQMPClient(q.qmpSockPath)
+		if err == nil {
+			return client, nil
+		}
+
+		lastErr = err
+		time.Sleep(qemuDialInterval)
+	}
+
+	return nil, fmt.Errorf("Unable to connect to QMP socket for pod %s: %s", q.podID, lastErr)
+}
+
+func (q *qemu) stopPod() error {
+	if q.qmp != nil {
+		q.qmp.execute("quit", nil)
+		q.qmp.close()
+		q.qmp = nil
+	}
+
+	if q.cmd != nil && q.cmd.Process != nil {
+		q.cmd.Process.Kill()
+		q.cmd.Wait()
+	}
+
+	return nil
+}
+
+func (q *qemu) pausePod() error {
+	if q.qmp == nil {
+		return fmt.Errorf("Pod %s is not running", q.podID)
+	}
+
+	_, err := q.qmp.execute("stop", nil)
+	return err
+}
+
+func (q *qemu) resumePod() error {
+	if q.qmp == nil {
+		return fmt.Errorf("Pod %s is not running", q.podID)
+	}
+
+	_, err := q.qmp.execute("cont", nil)
+	return err
+}
+
+// addDevice attaches devInfo at boot time, before startPod has been
+// called. Only vfioDev is supported: it is the only device type with a
+// concrete boot-argument representation (vfioBootArgs) in this tree.
+func (q *qemu) addDevice(devInfo interface{}, devType deviceType) error {
+	switch devType {
+	case vfioDev:
+		dev, ok := devInfo.(VFIODevice)
+		if !ok {
+			return fmt.Errorf("Unsupported device info type for VFIO: %T", devInfo)
+		}
+
+		bridge, slot, err := addDeviceToBridges(dev.BDF, q.bridges)
+		if err != nil {
+			return err
+		}
+
+		q.bootArgs = append(q.bootArgs, "-device", vfioBootArgs(dev, bridge, slot))
+
+		return nil
+	default:
+		return fmt.Errorf("Unsupported device type for QEMU: %v", devType)
+	}
+}
+
+// hotplugAddDevice attaches devInfo to an already running pod through
+// QMP device_add. Only vfioDev is supported, for the same reason as
+// addDevice.
+func (q *qemu) hotplugAddDevice(devInfo interface{}, devType deviceType) error {
+	if q.qmp == nil {
+		return fmt.Errorf("Pod %s is not running", q.podID)
+	}
+
+	switch devType {
+	case vfioDev:
+		dev, ok := devInfo.(VFIODevice)
+		if !ok {
+			return fmt.Errorf("Unsupported device info type for VFIO: %T", devInfo)
+		}
+
+		bridge, slot, err := addDeviceToBridges(dev.BDF, q.bridges)
+		if err != nil {
+			return err
+		}
+
+		if _, err := q.qmp.execute("device_add", vfioHotplugArgs(dev, bridge, slot)); err != nil {
+			bridge.removeDevice(dev.BDF)
+			return fmt.Errorf("Unable to hot plug VFIO device %s: %s", dev.BDF, err)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("Unsupported device type for QEMU hot-plug: %v", devType)
+	}
+}
+
+// hotplugRemoveDevice detaches devInfo from a running pod through QMP
+// device_del, freeing the bridge slot it was allocated from.
+func (q *qemu) hotplugRemoveDevice(devInfo interface{}, devType deviceType) error {
+	if q.qmp == nil {
+		return fmt.Errorf("Pod %s is not running", q.podID)
+	}
+
+	switch devType {
+	case vfioDev:
+		dev, ok := devInfo.(VFIODevice)
+		if !ok {
+			return fmt.Errorf("Unsupported device info type for VFIO: %T", devInfo)
+		}
+
+		if _, err := q.qmp.execute("device_del", map[string]interface{}{"id": dev.BDF}); err != nil {
+			return fmt.Errorf("Unable to hot unplug VFIO device %s: %s", dev.BDF, err)
+		}
+
+		removeDeviceFromBridges(dev.BDF, q.bridges)
+
+		return nil
+	default:
+		return fmt.Errorf("Unsupported device type for QEMU hot-unplug: %v", devType)
+	}
+}
+
+func (q *qemu) getPodConsole(podID string) string {
+	return q.consolePath
+}
+
+func (q *qemu) capabilities() capabilities {
+	return capabilities{vfioSupported: q.config.VFIOMode != VFIOModeDisabled}
+}
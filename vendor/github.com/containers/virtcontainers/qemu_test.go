@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2016 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestQemuConfig() HypervisorConfig {
+	return HypervisorConfig{
+		KernelPath:   "/guest/kernel",
+		ImagePath:    "/guest/image.img",
+		DefaultVCPUs: 2,
+		DefaultMemSz: 512,
+	}
+}
+
+func TestQemuCreatePodBuildsBootArgs(t *testing.T) {
+	config := newTestQemuConfig()
+	config.DefaultBridges = 1
+	if err := config.AddKernelParam(Param{Key: "console", Value: "ttyS1"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	q := &qemu{}
+	if err := q.init(config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := q.createPod(PodConfig{ID: "pod0"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	args := strings.Join(q.bootArgs, " ")
+
+	if !strings.Contains(args, "-kernel /guest/kernel") {
+		t.Fatalf("expected boot args to reference the kernel path, got: %s", args)
+	}
+
+	if !strings.Contains(args, "pci-bridge,id=pci-bridge-0") {
+		t.Fatalf("expected boot args to attach the allocated bridge, got: %s", args)
+	}
+
+	if !strings.Contains(args, "-qmp unix:") {
+		t.Fatalf("expected boot args to configure a QMP socket, got: %s", args)
+	}
+
+	// The user-supplied console= param overrides the backend's own
+	// default (console=hvc0) for the same key.
+	if !strings.Contains(args, "console=ttyS1") {
+		t.Fatalf("expected user kernel param to override the default console, got: %s", args)
+	}
+	if strings.Contains(args, "console=hvc0") {
+		t.Fatalf("expected the default console param to be overridden, got: %s", args)
+	}
+}
+
+// TestQemuCreatePodAttachesCloudInitKernelParam covers the kernel
+// parameter side of cloud-init attachment directly, instead of through
+// createPod's actual ISO generation: that shells out to genisoimage/
+// mkisofs (or mkfs.vfat/mcopy as a fallback), which the cloudinit package
+// itself does not unit test either since neither is guaranteed to be on
+// PATH in a test environment.
+func TestQemuCreatePodAttachesCloudInitKernelParam(t *testing.T) {
+	cloudInit := CloudInitConfig{UserData: []byte("#cloud-config\n")}
+
+	config := newTestQemuConfig()
+	if err := config.AddKernelParam(cloudInit.kernelParam()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	q := &qemu{}
+	if err := q.init(config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.createPod(PodConfig{ID: "pod1"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	args := strings.Join(q.bootArgs, " ")
+	if !strings.Contains(args, "ds=nocloud-net") {
+		t.Fatalf("expected the NoCloud kernel parameter to be appended, got: %s", args)
+	}
+}
+
+func TestQemuAddDeviceAppendsVFIOBootArg(t *testing.T) {
+	q := &qemu{}
+	if err := q.init(newTestQemuConfig()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.createPod(PodConfig{ID: "pod2"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	before := len(q.bootArgs)
+
+	dev := VFIODevice{BDF: "0000:00:02.0"}
+	if err := q.addDevice(dev, vfioDev); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	args := strings.Join(q.bootArgs[before:], " ")
+	if !strings.Contains(args, "vfio-pci,host=0000:00:02.0") {
+		t.Fatalf("expected a vfio-pci boot arg for the device, got: %s", args)
+	}
+
+	if len(q.bridges[0].Address) != 1 {
+		t.Fatalf("expected the VFIO device to occupy a bridge slot, got %d occupied slots", len(q.bridges[0].Address))
+	}
+}
+
+func TestQemuAddDeviceRejectsUnsupportedType(t *testing.T) {
+	q := &qemu{}
+	if err := q.init(newTestQemuConfig()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.createPod(PodConfig{ID: "pod3"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := q.addDevice(struct{}{}, netDev); err == nil {
+		t.Fatal("expected an error for a device type this backend does not support")
+	}
+}
+
+func TestQemuHotplugAddAndRemoveDeviceOverQMP(t *testing.T) {
+	var added, removed bool
+
+	sockPath := fakeQMPServer(t, func(request map[string]interface{}) interface{} {
+		switch request["execute"] {
+		case "device_add":
+			added = true
+			args, _ := request["arguments"].(map[string]interface{})
+			if args["id"] != "0000:00:02.0" {
+				t.Fatalf("expected device_add id to match the device BDF, got %v", args["id"])
+			}
+		case "device_del":
+			removed = true
+		}
+		return map[string]interface{}{"return": map[string]interface{}{}}
+	})
+
+	q := &qemu{}
+	if err := q.init(newTestQemuConfig()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.createPod(PodConfig{ID: "pod4"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	client, err := newQMPClient(sockPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q.qmp = client
+	defer client.close()
+
+	dev := VFIODevice{BDF: "0000:00:02.0"}
+	if err := q.hotplugAddDevice(dev, vfioDev); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !added {
+		t.Fatal("expected hotplugAddDevice to issue a QMP device_add")
+	}
+	if len(q.bridges[0].Address) != 1 {
+		t.Fatalf("expected the hot-plugged device to occupy a bridge slot, got %d", len(q.bridges[0].Address))
+	}
+
+	if err := q.hotplugRemoveDevice(dev, vfioDev); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !removed {
+		t.Fatal("expected hotplugRemoveDevice to issue a QMP device_del")
+	}
+	if len(q.bridges[0].Address) != 0 {
+		t.Fatalf("expected the bridge slot to be freed after hot-unplug, got %d occupied", len(q.bridges[0].Address))
+	}
+}
+
+func TestQemuHotplugAddDeviceWithoutRunningQMPFails(t *testing.T) {
+	q := &qemu{}
+	if err := q.init(newTestQemuConfig()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.createPod(PodConfig{ID: "pod5"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := q.hotplugAddDevice(VFIODevice{BDF: "0000:00:02.0"}, vfioDev); err == nil {
+		t.Fatal("expected an error hot-plugging into a pod with no running QMP connection")
+	}
+}
+
+func TestQemuCapabilitiesReflectVFIOMode(t *testing.T) {
+	q := &qemu{}
+
+	config := newTestQemuConfig()
+	config.VFIOMode = VFIOModeDisabled
+	if err := q.init(config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if q.capabilities().supportsVFIO() {
+		t.Fatal("expected capabilities to report no VFIO support when VFIOMode is disabled")
+	}
+
+	config.VFIOMode = VFIOModeGuestKernel
+	if err := q.init(config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !q.capabilities().supportsVFIO() {
+		t.Fatal("expected capabilities to report VFIO support when VFIOMode is enabled")
+	}
+}
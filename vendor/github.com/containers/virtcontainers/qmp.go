@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// qmpGreeting is the banner QEMU sends as soon as a client connects to its
+// QMP socket, before any command can be issued.
+type qmpGreeting struct {
+	QMP struct {
+		Version interface{} `json:"version"`
+	} `json:"QMP"`
+}
+
+// qmpResponse is the shape of a QMP command reply: either a "return" on
+// success or an "error" describing what went wrong.
+type qmpResponse struct {
+	Return interface{} `json:"return"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+// qmpClient is a minimal QEMU Machine Protocol client used to issue
+// runtime commands, chiefly device_add/device_del, over the unix socket
+// QEMU exposes when started with "-qmp unix:<path>,server,nowait".
+type qmpClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newQMPClient dials the QMP unix socket at path and completes the
+// qmp_capabilities negotiation every QMP session requires before any
+// other command is accepted.
+func newQMPClient(path string) (*qmpClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &qmpClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	var greeting qmpGreeting
+	if err := c.readInto(&greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Unable to read QMP greeting: %s", err)
+	}
+
+	if _, err := c.execute("qmp_capabilities", nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Unable to negotiate QMP capabilities: %s", err)
+	}
+
+	return c, nil
+}
+
+// execute sends a QMP command with optional arguments and returns its
+// "return" payload.
+func (c *qmpClient) execute(command string, args map[string]interface{}) (interface{}, error) {
+	request := map[string]interface{}{"execute": command}
+	if args != nil {
+		request["arguments"] = args
+	}
+
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.conn.Write(append(encoded, '\n')); err != nil {
+		return nil, fmt.Errorf("Unable to send QMP command %s: %s", command, err)
+	}
+
+	var resp qmpResponse
+	if err := c.readInto(&resp); err != nil {
+		return nil, fmt.Errorf("Unable to read QMP response to %s: %s", command, err)
+	}
+
+	if resp.Error != nil {
+		return nil, fmt.Errorf("QMP command %s failed: %s: %s", command, resp.Error.Class, resp.Error.Desc)
+	}
+
+	return resp.Return, nil
+}
+
+// readInto reads a single newline-delimited JSON document from the QMP
+// connection into v, skipping asynchronous events along the way (they
+// carry an "event" key instead of "return"/"error"/"QMP").
+func (c *qmpClient) readInto(v interface{}) error {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		var probe map[string]interface{}
+		if err := json.Unmarshal(line, &probe); err != nil {
+			return err
+		}
+
+		if _, isEvent := probe["event"]; isEvent {
+			continue
+		}
+
+		return json.Unmarshal(line, v)
+	}
+}
+
+// close closes the underlying QMP connection.
+func (c *qmpClient) close() error {
+	return c.conn.Close()
+}
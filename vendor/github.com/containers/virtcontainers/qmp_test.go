@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// fakeQMPServer listens on a unix socket under t.TempDir(), sends the QMP
+// greeting and acks qmp_capabilities on the first connection, then hands
+// every subsequent request/response pair to handle. It returns the socket
+// path.
+func fakeQMPServer(t *testing.T, handle func(request map[string]interface{}) interface{}) string {
+	t.Helper()
+
+	sockPath := filepath.Join(t.TempDir(), "qmp.sock")
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("unable to listen on fake QMP socket: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		writeLine(conn, map[string]interface{}{"QMP": map[string]interface{}{"version": "1.0"}})
+
+		reader := bufio.NewReader(conn)
+
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+
+			var request map[string]interface{}
+			if err := json.Unmarshal(line, &request); err != nil {
+				return
+			}
+
+			if request["execute"] == "qmp_capabilities" {
+				writeLine(conn, map[string]interface{}{"return": map[string]interface{}{}})
+				continue
+			}
+
+			writeLine(conn, handle(request))
+		}
+	}()
+
+	return sockPath
+}
+
+func writeLine(conn net.Conn, v interface{}) {
+	encoded, _ := json.Marshal(v)
+	conn.Write(append(encoded, '\n'))
+}
+
+func TestNewQMPClientNegotiatesCapabilities(t *testing.T) {
+	sockPath := fakeQMPServer(t, func(request map[string]interface{}) interface{} {
+		return map[string]interface{}{"return": map[string]interface{}{}}
+	})
+
+	client, err := newQMPClient(sockPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer client.close()
+}
+
+func TestQMPClientExecuteReturnsResult(t *testing.T) {
+	sockPath := fakeQMPServer(t, func(request map[string]interface{}) interface{} {
+		if request["execute"] != "device_add" {
+			t.Fatalf("expected execute=device_add, got %v", request["execute"])
+		}
+		return map[string]interface{}{"return": map[string]interface{}{}}
+	})
+
+	client, err := newQMPClient(sockPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer client.close()
+
+	if _, err := client.execute("device_add", map[string]interface{}{"id": "dev0"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestQMPClientExecutePropagatesError(t *testing.T) {
+	sockPath := fakeQMPServer(t, func(request map[string]interface{}) interface{} {
+		return map[string]interface{}{"error": map[string]interface{}{
+			"class": "GenericError",
+			"desc":  "device already exists",
+		}}
+	})
+
+	client, err := newQMPClient(sockPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer client.close()
+
+	_, err = client.execute("device_add", map[string]interface{}{"id": "dev0"})
+	if err == nil {
+		t.Fatal("expected an error from a QMP response carrying an \"error\" field")
+	}
+}
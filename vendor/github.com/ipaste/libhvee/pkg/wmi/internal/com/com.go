@@ -0,0 +1,324 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build windows
+
+// Package com implements the small slice of COM/OLE late-bound
+// automation (CoCreateInstance + IDispatch::Invoke) needed to drive WMI's
+// scripting objects (SWbemLocator, SWbemServices, SWbemObject,
+// SWbemMethod). It intentionally only supports scalar arguments
+// (strings, booleans, integers) or other automation objects, and results
+// that are either scalar or
+// another automation object, since that covers every call the wmi
+// package needs to make; it is not a general purpose COM binding.
+package com
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	ole32  = syscall.NewLazyDLL("ole32.dll")
+	oleaut = syscall.NewLazyDLL("oleaut32.dll")
+
+	procCoInitializeEx   = ole32.NewProc("CoInitializeEx")
+	procCLSIDFromProgID  = ole32.NewProc("CLSIDFromProgID")
+	procCoCreateInstance = ole32.NewProc("CoCreateInstance")
+	procSysAllocString   = oleaut.NewProc("SysAllocString")
+	procSysFreeString    = oleaut.NewProc("SysFreeString")
+
+	initOnce sync.Once
+)
+
+const (
+	clsctxInprocServer      = 1
+	coinitApartmentThreaded = 0x2
+
+	dispatchMethod      = 0x1
+	dispatchPropertyGet = 0x2
+)
+
+// COM VARIANT type tags (VARENUM), limited to the handful this package
+// produces or consumes.
+const (
+	vtEmpty    = 0
+	vtI4       = 3
+	vtBSTR     = 8
+	vtDispatch = 9
+	vtBool     = 11
+	vtUI2      = 18
+	vtUI4      = 19
+)
+
+// ensureInitialized calls CoInitializeEx once for the process. WMI
+// scripting objects are apartment threaded; callers are expected to keep
+// their use of a single Client serialized, which the wmi package does
+// with its own mutex.
+func ensureInitialized() {
+	initOnce.Do(func() {
+		procCoInitializeEx.Call(0, uintptr(coinitApartmentThreaded))
+	})
+}
+
+// guid mirrors the Windows GUID/CLSID/IID layout.
+type guid struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// iidIDispatch is IID_IDispatch: {00020400-0000-0000-C000-000000000046}.
+var iidIDispatch = guid{0x00020400, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}}
+
+// variant mirrors the Windows x64 VARIANT layout: an 8 byte header
+// (type tag plus three reserved words) followed by an 8 byte value slot
+// and 8 bytes of tail padding, for a total of 24 bytes.
+type variant struct {
+	vt         uint16
+	wReserved1 uint16
+	wReserved2 uint16
+	wReserved3 uint16
+	val        int64
+	_          int64
+}
+
+// dispParams mirrors DISPPARAMS.
+type dispParams struct {
+	rgvarg            uintptr
+	rgdispidNamedArgs uintptr
+	cArgs             uint32
+	cNamedArgs        uint32
+}
+
+// dispatchVtbl mirrors the layout of IDispatch's vtable: IUnknown's
+// three methods followed by IDispatch's four.
+type dispatchVtbl struct {
+	QueryInterface   uintptr
+	AddRef           uintptr
+	Release          uintptr
+	GetTypeInfoCount uintptr
+	GetTypeInfo      uintptr
+	GetIDsOfNames    uintptr
+	Invoke           uintptr
+}
+
+// Object wraps a COM IDispatch pointer obtained either by CreateObject or
+// as the result of a prior Call. A scalar (VT_BSTR) result carries no
+// IDispatch pointer at all; str holds its value instead, read back via
+// String().
+type Object struct {
+	disp unsafe.Pointer
+	str  string
+}
+
+func (o *Object) vtbl() *dispatchVtbl {
+	return (*dispatchVtbl)(*(*unsafe.Pointer)(o.disp))
+}
+
+// CreateObject creates an in-process COM object by ProgID (e.g.
+// "WbemScripting.SWbemLocator") and returns it wrapped as an Object.
+func CreateObject(progID string) (*Object, error) {
+	ensureInitialized()
+
+	progIDPtr, err := syscall.UTF16PtrFromString(progID)
+	if err != nil {
+		return nil, err
+	}
+
+	var clsid guid
+	if r, _, _ := procCLSIDFromProgID.Call(uintptr(unsafe.Pointer(progIDPtr)), uintptr(unsafe.Pointer(&clsid))); r != 0 {
+		return nil, fmt.Errorf("CLSIDFromProgID(%s) failed with HRESULT 0x%x", progID, r)
+	}
+	runtime.KeepAlive(progIDPtr)
+
+	var disp unsafe.Pointer
+	r, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsid)),
+		0,
+		clsctxInprocServer,
+		uintptr(unsafe.Pointer(&iidIDispatch)),
+		uintptr(unsafe.Pointer(&disp)),
+	)
+	if r != 0 {
+		return nil, fmt.Errorf("CoCreateInstance(%s) failed with HRESULT 0x%x", progID, r)
+	}
+
+	return &Object{disp: disp}, nil
+}
+
+// dispIDOf resolves method's DISPID on o via IDispatch::GetIDsOfNames.
+func (o *Object) dispIDOf(method string) (int32, error) {
+	namePtr, err := syscall.UTF16PtrFromString(method)
+	if err != nil {
+		return 0, err
+	}
+
+	var iidNull guid
+	var dispID int32
+
+	r, _, _ := syscall.Syscall6(
+		o.vtbl().GetIDsOfNames,
+		6,
+		uintptr(o.disp),
+		uintptr(unsafe.Pointer(&iidNull)),
+		uintptr(unsafe.Pointer(&namePtr)),
+		1,
+		0,
+		uintptr(unsafe.Pointer(&dispID)),
+	)
+	runtime.KeepAlive(namePtr)
+
+	if r != 0 {
+		return 0, fmt.Errorf("GetIDsOfNames(%s) failed with HRESULT 0x%x", method, r)
+	}
+
+	return dispID, nil
+}
+
+// toVariant converts a Go scalar into the VARIANT this package's Invoke
+// understands, returning a cleanup func that must run once the call
+// using it has returned.
+func toVariant(arg interface{}) (variant, func(), error) {
+	switch v := arg.(type) {
+	case string:
+		ptr, err := syscall.UTF16PtrFromString(v)
+		if err != nil {
+			return variant{}, func() {}, err
+		}
+		bstr, _, _ := procSysAllocString.Call(uintptr(unsafe.Pointer(ptr)))
+		runtime.KeepAlive(ptr)
+		return variant{vt: vtBSTR, val: int64(bstr)}, func() { procSysFreeString.Call(bstr) }, nil
+	case bool:
+		val := int64(0)
+		if v {
+			val = -1
+		}
+		return variant{vt: vtBool, val: val}, func() {}, nil
+	case uint16:
+		return variant{vt: vtUI2, val: int64(v)}, func() {}, nil
+	case uint32:
+		return variant{vt: vtUI4, val: int64(v)}, func() {}, nil
+	case int:
+		return variant{vt: vtI4, val: int64(v)}, func() {}, nil
+	case *Object:
+		return variant{vt: vtDispatch, val: int64(uintptr(v.disp))}, func() {}, nil
+	default:
+		return variant{}, func() {}, fmt.Errorf("unsupported COM argument type %T", arg)
+	}
+}
+
+// fromVariant converts an Invoke result back into either a *Object (for
+// VT_DISPATCH) or a scalar Object that String() can read (for VT_BSTR).
+func fromVariant(v variant) *Object {
+	switch v.vt {
+	case vtDispatch:
+		return &Object{disp: unsafe.Pointer(uintptr(v.val))}
+	case vtBSTR:
+		bstr := uintptr(v.val)
+		defer procSysFreeString.Call(bstr)
+		return &Object{str: bstrToString(bstr)}
+	default:
+		return &Object{}
+	}
+}
+
+// bstrToString reads a BSTR (a length-prefixed, NUL-terminated UTF-16
+// string) into a Go string.
+func bstrToString(bstr uintptr) string {
+	if bstr == 0 {
+		return ""
+	}
+
+	var length int
+	for {
+		c := *(*uint16)(unsafe.Pointer(bstr + uintptr(length)*2))
+		if c == 0 {
+			break
+		}
+		length++
+	}
+
+	slice := unsafe.Slice((*uint16)(unsafe.Pointer(bstr)), length)
+	return syscall.UTF16ToString(slice)
+}
+
+// Call invokes method on o with args (each of which must be a type
+// toVariant understands) via IDispatch::Invoke, returning whatever it
+// returns wrapped as an Object.
+func (o *Object) Call(method string, args ...interface{}) (*Object, error) {
+	dispID, err := o.dispIDOf(method)
+	if err != nil {
+		return nil, err
+	}
+
+	// COM passes arguments to Invoke in reverse order.
+	vargs := make([]variant, len(args))
+	var cleanups []func()
+	defer func() {
+		for _, c := range cleanups {
+			c()
+		}
+	}()
+
+	for i, a := range args {
+		v, cleanup, err := toVariant(a)
+		if err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %s", method, i, err)
+		}
+		cleanups = append(cleanups, cleanup)
+		vargs[len(args)-1-i] = v
+	}
+
+	params := dispParams{cArgs: uint32(len(vargs))}
+	if len(vargs) > 0 {
+		params.rgvarg = uintptr(unsafe.Pointer(&vargs[0]))
+	}
+
+	var result variant
+	var iidNull guid
+
+	r, _, _ := syscall.Syscall9(
+		o.vtbl().Invoke,
+		9,
+		uintptr(o.disp),
+		uintptr(dispID),
+		uintptr(unsafe.Pointer(&iidNull)),
+		0,
+		uintptr(dispatchMethod|dispatchPropertyGet),
+		uintptr(unsafe.Pointer(&params)),
+		uintptr(unsafe.Pointer(&result)),
+		0,
+		0,
+	)
+	runtime.KeepAlive(vargs)
+
+	if r != 0 {
+		return nil, fmt.Errorf("%s failed with HRESULT 0x%x", method, r)
+	}
+
+	return fromVariant(result), nil
+}
+
+// String returns the string value of a scalar result Object, e.g. the
+// BSTR returned by reading the "ResultingSystem" property.
+func (o *Object) String() string {
+	return o.str
+}
@@ -0,0 +1,310 @@
+//
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build windows
+
+// Package wmi is a small client for the root\virtualization\v2 WMI
+// namespace (the Hyper-V Virtual Machine Management Service), built
+// directly on COM automation through WbemScripting.SWbemLocator. It
+// exists so the hyperv hypervisor backend can drive Hyper-V without
+// shelling out to PowerShell and without a general-purpose COM binding
+// library as a dependency.
+package wmi
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ipaste/libhvee/pkg/wmi/internal/com"
+)
+
+// namespace is the WMI namespace the Virtual Machine Management Service
+// lives under.
+const namespace = `root\virtualization\v2`
+
+// RequestedState mirrors Msvm_ComputerSystem's RequestedState values.
+type RequestedState uint16
+
+const (
+	// RequestedStateEnabled starts (or resumes) the virtual machine.
+	RequestedStateEnabled RequestedState = 2
+
+	// RequestedStateDisabled stops the virtual machine.
+	RequestedStateDisabled RequestedState = 3
+
+	// RequestedStatePaused pauses the virtual machine.
+	RequestedStatePaused RequestedState = 32769
+)
+
+// Msvm_VirtualSystemSettingData mirrors the WMI class of the same name:
+// the top level settings of a virtual machine.
+type Msvm_VirtualSystemSettingData struct {
+	ElementName          string
+	VirtualSystemType    string
+	VirtualSystemSubType string
+	SecureBootEnabled    bool
+
+	// instancePath is filled in once the setting data has been realized
+	// through the management service, and is used to address the
+	// virtual machine in later calls.
+	instancePath string
+}
+
+func (s *Msvm_VirtualSystemSettingData) embeddedInstance() string {
+	return mofInstance("Msvm_VirtualSystemSettingData",
+		mofString("ElementName", s.ElementName),
+		mofString("VirtualSystemType", s.VirtualSystemType),
+		mofString("VirtualSystemSubType", s.VirtualSystemSubType),
+		mofBool("SecureBootEnabled", s.SecureBootEnabled),
+	)
+}
+
+// Msvm_ProcessorSettingData mirrors the WMI class of the same name: the
+// virtual machine's virtual CPU allocation.
+type Msvm_ProcessorSettingData struct {
+	VirtualQuantity uint32
+}
+
+func (s *Msvm_ProcessorSettingData) embeddedInstance() string {
+	return mofInstance("Msvm_ProcessorSettingData", mofUint("VirtualQuantity", uint64(s.VirtualQuantity)))
+}
+
+// Msvm_MemorySettingData mirrors the WMI class of the same name: the
+// virtual machine's memory allocation.
+type Msvm_MemorySettingData struct {
+	VirtualQuantity      uint64
+	DynamicMemoryEnabled bool
+}
+
+func (s *Msvm_MemorySettingData) embeddedInstance() string {
+	return mofInstance("Msvm_MemorySettingData",
+		mofUint("VirtualQuantity", s.VirtualQuantity),
+		mofBool("DynamicMemoryEnabled", s.DynamicMemoryEnabled),
+	)
+}
+
+// Msvm_ResourceAllocationSettingData mirrors the WMI class of the same
+// name, used for every other resource (storage controllers, drives,
+// VFIO-style assigned devices) attached to a virtual machine.
+type Msvm_ResourceAllocationSettingData struct {
+	ResourceSubType string
+	HostResource    []string
+}
+
+func (s *Msvm_ResourceAllocationSettingData) embeddedInstance() string {
+	return mofInstance("Msvm_ResourceAllocationSettingData",
+		mofString("ResourceSubType", s.ResourceSubType),
+		mofStringArray("HostResource", s.HostResource),
+	)
+}
+
+// Msvm_SyntheticEthernetPortSettingData mirrors the WMI class of the same
+// name: a synthetic network adapter.
+type Msvm_SyntheticEthernetPortSettingData struct {
+	ElementName string
+}
+
+func (s *Msvm_SyntheticEthernetPortSettingData) embeddedInstance() string {
+	return mofInstance("Msvm_SyntheticEthernetPortSettingData", mofString("ElementName", s.ElementName))
+}
+
+// SettingData is implemented by every Msvm_*SettingData type above, each
+// of which can render itself as a MOF embedded-instance string. The
+// management service methods accept settings this way (rather than as
+// structured COM arguments) so that the underlying com package only ever
+// has to marshal scalar VARIANTs.
+type SettingData interface {
+	embeddedInstance() string
+}
+
+// mofInstance renders a MOF "instance of ClassName { ... };" embedded
+// instance string from already-formatted "Key = value;" fields.
+func mofInstance(className string, fields ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "instance of %s\n{\n", className)
+	for _, f := range fields {
+		fmt.Fprintf(&b, "\t%s\n", f)
+	}
+	b.WriteString("};")
+	return b.String()
+}
+
+func mofString(key, value string) string {
+	return fmt.Sprintf("%s = %q;", key, value)
+}
+
+func mofBool(key string, value bool) string {
+	return fmt.Sprintf("%s = %t;", key, value)
+}
+
+func mofUint(key string, value uint64) string {
+	return fmt.Sprintf("%s = %d;", key, value)
+}
+
+func mofStringArray(key string, values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf("%s = {%s};", key, strings.Join(quoted, ", "))
+}
+
+// Client talks to the Virtual Machine Management Service over WMI.
+type Client struct {
+	mu  sync.Mutex
+	svc *com.Object
+}
+
+// NewClient connects to the root\virtualization\v2 namespace on the
+// local host and returns a Client bound to its management service.
+func NewClient() (*Client, error) {
+	locator, err := com.CreateObject("WbemScripting.SWbemLocator")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create SWbemLocator: %s", err)
+	}
+
+	svc, err := locator.Call("ConnectServer", "", namespace)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %s", namespace, err)
+	}
+
+	return &Client{svc: svc}, nil
+}
+
+// managementService fetches the singleton
+// Msvm_VirtualSystemManagementService instance used to define and modify
+// virtual machines.
+func (c *Client) managementService() (*com.Object, error) {
+	return c.svc.Call("Get", "Msvm_VirtualSystemManagementService=@")
+}
+
+// DefineSystem realizes a new virtual machine from systemSettings,
+// processorSettings and memorySettings, recording the resulting instance
+// path on systemSettings for later calls.
+func (c *Client) DefineSystem(systemSettings *Msvm_VirtualSystemSettingData, processorSettings *Msvm_ProcessorSettingData, memorySettings *Msvm_MemorySettingData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mgmt, err := c.managementService()
+	if err != nil {
+		return err
+	}
+
+	result, err := mgmt.Call("DefineSystem",
+		systemSettings.embeddedInstance(),
+		processorSettings.embeddedInstance(),
+		memorySettings.embeddedInstance(),
+	)
+	if err != nil {
+		return fmt.Errorf("DefineSystem failed: %s", err)
+	}
+
+	path, err := result.Call("Get", "ResultingSystem")
+	if err != nil {
+		return fmt.Errorf("DefineSystem did not return a resulting system: %s", err)
+	}
+
+	systemSettings.instancePath = path.String()
+
+	return nil
+}
+
+// AddResources attaches resources (drives, controllers, network ports)
+// described by resourceSettings to the virtual machine identified by
+// systemSettings. The real AddResourceSettings method takes its settings
+// as a single array argument; this client instead calls it once per
+// resource, since the com package this is built on only marshals scalar
+// VARIANTs, not SAFEARRAYs.
+func (c *Client) AddResources(systemSettings *Msvm_VirtualSystemSettingData, resourceSettings ...SettingData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mgmt, err := c.managementService()
+	if err != nil {
+		return err
+	}
+
+	for _, rs := range resourceSettings {
+		if _, err := mgmt.Call("AddResourceSettings", systemSettings.instancePath, rs.embeddedInstance()); err != nil {
+			return fmt.Errorf("AddResourceSettings failed: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveResources detaches resourceSettings from the virtual machine
+// identified by systemSettings, one call per resource for the same
+// reason as AddResources.
+func (c *Client) RemoveResources(systemSettings *Msvm_VirtualSystemSettingData, resourceSettings ...SettingData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mgmt, err := c.managementService()
+	if err != nil {
+		return err
+	}
+
+	for _, rs := range resourceSettings {
+		if _, err := mgmt.Call("RemoveResourceSettings", rs.embeddedInstance()); err != nil {
+			return fmt.Errorf("RemoveResourceSettings failed: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// ConnectToSwitch attaches port, a synthetic Ethernet port, to the
+// virtual machine identified by systemSettings and connects it to the
+// named virtual switch.
+func (c *Client) ConnectToSwitch(systemSettings *Msvm_VirtualSystemSettingData, port *Msvm_SyntheticEthernetPortSettingData, switchName string) error {
+	if err := c.AddResources(systemSettings, port); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mgmt, err := c.managementService()
+	if err != nil {
+		return err
+	}
+
+	if _, err := mgmt.Call("ConnectSwitch", port.ElementName, switchName); err != nil {
+		return fmt.Errorf("ConnectSwitch failed: %s", err)
+	}
+
+	return nil
+}
+
+// RequestStateChange requests that the virtual machine identified by
+// systemSettings transition to state.
+func (c *Client) RequestStateChange(systemSettings *Msvm_VirtualSystemSettingData, state RequestedState) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	system, err := c.svc.Call("Get", systemSettings.instancePath)
+	if err != nil {
+		return fmt.Errorf("unable to resolve virtual machine %s: %s", systemSettings.instancePath, err)
+	}
+
+	if _, err := system.Call("RequestStateChange", uint16(state)); err != nil {
+		return fmt.Errorf("RequestStateChange(%d) failed: %s", state, err)
+	}
+
+	return nil
+}